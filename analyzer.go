@@ -18,6 +18,8 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"sort"
 	"strings"
 	"unicode"
@@ -47,8 +49,8 @@ func addIfUnique_ASC(sl [][]int, v int) [][]int {
 	}
 	// Skim over all the inferior numbers
 	ii := 0
-	for i := 0; i < len(sl) && v > sl[i][0]; i++ {
-		ii = i
+	for ii < len(sl) && v > sl[ii][0] {
+		ii++
 	}
 	// Am I the biggest daddy here?
 	if ii < len(sl) {
@@ -93,3 +95,57 @@ func hasUpperCaseChars(st []byte) bool {
 	}
 	return false
 }
+
+// Checks that dice codes found in the dictionary cover the whole code space of
+// the given dice exactly once: every word has a code, every code has one number
+// per die within the range of that die, and no two words share a code.
+// Returns a slice that maps the value of rolled dice (see diceValue) onto
+// the index of the word bearing that code. If none of the words had a code,
+// returns nil and no error
+func checkDiceCodes(codes []DiceCode, dice []int) ([]int, error) {
+	present := false
+	for _, code := range codes {
+		if code != nil {
+			present = true
+			break
+		}
+	}
+	if !present {
+		return nil, nil
+	}
+	if len(dice) == 0 {
+		return nil, errors.New("no dice to roll")
+	}
+	codeSpace := 1
+	for _, faces := range dice {
+		codeSpace = codeSpace * faces
+	}
+	if len(codes) != codeSpace {
+		return nil, fmt.Errorf("there are %d words, but %d different outcomes of rolling %d dice", len(codes), codeSpace, len(dice))
+	}
+	codeIndex := make([]int, codeSpace)
+	for i := range codeIndex {
+		codeIndex[i] = -1
+	}
+	for i, code := range codes {
+		if code == nil {
+			return nil, fmt.Errorf("word number %d has no dice code", i+1)
+		}
+		if len(code) != len(dice) {
+			return nil, fmt.Errorf("dice code %s of word number %d is for %d dice rather than %d", code, i+1, len(code), len(dice))
+		}
+		for j, rolled := range code {
+			if rolled < 1 || rolled > dice[j] {
+				return nil, fmt.Errorf("dice code %s of word number %d can't be rolled: die number %d has %d faces", code, i+1, j+1, dice[j])
+			}
+		}
+		v := diceValue(code, dice)
+		if codeIndex[v] != -1 {
+			return nil, fmt.Errorf("dice code %s is shared by words number %d and %d", code, codeIndex[v]+1, i+1)
+		}
+		codeIndex[v] = i
+	}
+	// Pigeonhole principle: as many distinct valid codes as there are outcomes
+	// means none of the outcomes were missed
+	return codeIndex, nil
+}
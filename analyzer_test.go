@@ -58,6 +58,9 @@ func TestGetDistinctCountsAndDoPrefixCheck(t *testing.T) {
 		analyzer_testrecord{input: []string{"dog", "cat", "donut", "nutjob", "nutcat", "catdoggery"}, distinctCounts: [][]int{{1, 6}}, prefixExists: true},
 		analyzer_testrecord{input: []string{"dog", "cat", "doggerel", "gerelcat"}, distinctCounts: [][]int{{1, 4}}, prefixExists: true},
 		analyzer_testrecord{input: []string{"doggie", "catmonster", "doggerel", "doggy"}, distinctCounts: [][]int{{1, 4}}, prefixExists: false},
+		// Counts found in any order must come out sorted
+		analyzer_testrecord{input: []string{"ant", "bee", "bee", "cow", "cow", "cow", "elk", "elk", "elk", "elk"},
+			distinctCounts: [][]int{{1, 1}, {2, 1}, {3, 1}, {4, 1}}, prefixExists: false},
 	}
 	for num, testrecord := range dataset {
 		dupTracker := produceDupTracker(testrecord.input)
@@ -68,3 +71,80 @@ func TestGetDistinctCountsAndDoPrefixCheck(t *testing.T) {
 		}
 	}
 }
+
+type addIfUniqueASC_testrecord struct {
+	values         []int
+	distinctCounts [][]int
+}
+
+func TestAddIfUniqueASC(t *testing.T) {
+	dataset := []addIfUniqueASC_testrecord{
+		addIfUniqueASC_testrecord{values: []int{1, 2}, distinctCounts: [][]int{{1, 1}, {2, 1}}},
+		addIfUniqueASC_testrecord{values: []int{2, 1}, distinctCounts: [][]int{{1, 1}, {2, 1}}},
+		addIfUniqueASC_testrecord{values: []int{1, 3, 2, 3}, distinctCounts: [][]int{{1, 1}, {2, 1}, {3, 2}}},
+		addIfUniqueASC_testrecord{values: []int{3, 1, 4, 1}, distinctCounts: [][]int{{1, 2}, {3, 1}, {4, 1}}},
+	}
+	for num, testrecord := range dataset {
+		cnts := make([][]int, 0)
+		for _, v := range testrecord.values {
+			cnts = addIfUnique_ASC(cnts, v)
+		}
+		if !cmpDistinctCounts(cnts, testrecord.distinctCounts) {
+			t.Errorf("test number %d failed\n   got: %v\n   expected: %v\n", num+1, cnts, testrecord.distinctCounts)
+		}
+	}
+}
+
+type checkDiceCodes_testrecord struct {
+	codes     []string
+	dice      []int
+	codeIndex []int
+	valid     bool
+}
+
+func TestCheckDiceCodes(t *testing.T) {
+	dataset := []checkDiceCodes_testrecord{
+		checkDiceCodes_testrecord{codes: []string{"11", "12", "21", "22"}, dice: []int{2, 2}, codeIndex: []int{0, 1, 2, 3}, valid: true},
+		checkDiceCodes_testrecord{codes: []string{"22", "12", "21", "11"}, dice: []int{2, 2}, codeIndex: []int{3, 1, 2, 0}, valid: true},
+		checkDiceCodes_testrecord{codes: []string{"1-1", "1-2", "1-3", "2-1", "2-2", "2-3"}, dice: []int{2, 3}, codeIndex: []int{0, 1, 2, 3, 4, 5}, valid: true},
+		checkDiceCodes_testrecord{codes: []string{"", "", "", ""}, dice: []int{2, 2}, codeIndex: nil, valid: true},
+		// duplicate code, missing "22"
+		checkDiceCodes_testrecord{codes: []string{"11", "12", "21", "21"}, dice: []int{2, 2}, valid: false},
+		// code out of range for these dice
+		checkDiceCodes_testrecord{codes: []string{"11", "12", "13", "21"}, dice: []int{2, 2}, valid: false},
+		// one word without code
+		checkDiceCodes_testrecord{codes: []string{"11", "12", "", "22"}, dice: []int{2, 2}, valid: false},
+		// wrong number of dice
+		checkDiceCodes_testrecord{codes: []string{"1", "2", "3", "4"}, dice: []int{2, 2}, valid: false},
+		// not enough words to cover all outcomes
+		checkDiceCodes_testrecord{codes: []string{"11", "12", "21"}, dice: []int{2, 2}, valid: false},
+	}
+	for num, testrecord := range dataset {
+		codes := make([]DiceCode, 0, len(testrecord.codes))
+		for _, s := range testrecord.codes {
+			if s == "" {
+				codes = append(codes, nil)
+			} else {
+				codes = append(codes, parseDiceCode([]byte(s)))
+			}
+		}
+		codeIndex, err := checkDiceCodes(codes, testrecord.dice)
+		if (err == nil) != testrecord.valid {
+			t.Errorf("test number %d failed\n   got error: %v\n   expected valid: %t\n", num+1, err, testrecord.valid)
+			continue
+		}
+		if !testrecord.valid {
+			continue
+		}
+		if len(codeIndex) != len(testrecord.codeIndex) {
+			t.Errorf("test number %d failed\n   got: %v\n   expected: %v\n", num+1, codeIndex, testrecord.codeIndex)
+			continue
+		}
+		for i := range codeIndex {
+			if codeIndex[i] != testrecord.codeIndex[i] {
+				t.Errorf("test number %d failed\n   got: %v\n   expected: %v\n", num+1, codeIndex, testrecord.codeIndex)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains random source that relies on user drawing cards from
+// a shuffled deck of 52 playing cards
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const CARDS_IN_DECK = 52
+
+// Ranks and suits in the order that defines card numbers: ace of clubs
+// is card number 0, king of spades is card number 51
+var CARD_RANKS = []string{"A", "2", "3", "4", "5", "6", "7", "8", "9", "10", "J", "Q", "K"}
+var CARD_SUITS = []string{"C", "D", "H", "S"}
+
+// Cards drawn from a well shuffled deck without replacement form a random
+// permutation. The position of each drawn card among the cards still in
+// the deck is a uniformly distributed digit, whose radix is the number
+// of cards left in the deck, and digits are independent of each other
+// (this is the factorial number system, also known as Lehmer code).
+// Digits are combined into a value for a word the same way as dice rolls,
+// and values that are out of range are rejected
+type CardsImpl struct {
+	// Words in the wordlist, and words chosen so far
+	words  int
+	chosen int
+	// Cards that were drawn since the deck was last shuffled
+	drawn    [CARDS_IN_DECK]bool
+	left     int
+	shuffled bool
+}
+
+// Any number of words can be addressed by drawing more cards
+func (c *CardsImpl) Usable(totalWords int) int {
+	return totalWords
+}
+
+// The deck is not shuffled anew for every passphrase, the cards left in it
+// are as random as the whole deck
+func (c *CardsImpl) BeginSession(totalWords int, numWords int64, bits float64) error {
+	c.words = totalWords
+	c.chosen = 0
+	return nil
+}
+
+func (c *CardsImpl) EndSession(p *Passphrase) error {
+	return nil
+}
+
+func (c *CardsImpl) Restart() {
+	c.chosen = 0
+}
+
+// Parses card such as "AS" (ace of spades), "10h" or "Td" (ten of hearts,
+// ten of diamonds) into card number
+func parseCard(card []byte) (int, error) {
+	card = bytes.TrimSpace(card)
+	if len(card) < 2 {
+		return 0, errors.New("invalid card, expected rank followed by suit, such as QH or 10S")
+	}
+	rank := card[:len(card)-1]
+	suit := card[len(card)-1:]
+	if bytes.EqualFold(rank, []byte("T")) {
+		rank = []byte("10")
+	}
+	for s, suitName := range CARD_SUITS {
+		if !bytes.EqualFold(suit, []byte(suitName)) {
+			continue
+		}
+		for r, rankName := range CARD_RANKS {
+			if bytes.EqualFold(rank, []byte(rankName)) {
+				return s*len(CARD_RANKS) + r, nil
+			}
+		}
+		return 0, fmt.Errorf("invalid rank of card, should be one of %s", strings.Join(CARD_RANKS, ", "))
+	}
+	return 0, fmt.Errorf("invalid suit of card, should be one of %s", strings.Join(CARD_SUITS, ", "))
+}
+
+func (c *CardsImpl) shuffle() {
+	if c.shuffled {
+		releaseSecret(readSecretLine("Put all cards back into the deck, shuffle it thoroughly and press Enter. "))
+	} else {
+		releaseSecret(readSecretLine("Shuffle the deck of 52 cards thoroughly and press Enter. "))
+	}
+	for i := range c.drawn {
+		c.drawn[i] = false
+	}
+	c.left = CARDS_IN_DECK
+	c.shuffled = true
+}
+
+// Returns Lehmer code digit of the card that was drawn, which is the number
+// of cards left in the deck that precede it, and its radix. The deck is
+// reshuffled when only one card remains, as that card carries no randomness
+func (c *CardsImpl) drawCard(i int) (int, int) {
+	if c.left < 2 {
+		c.shuffle()
+	}
+	for {
+		line := readSecretLine(fmt.Sprintf("Draw card number %d. Which card is it? ", i+1))
+		card, err := parseCard(line)
+		releaseSecret(line)
+		if err != nil {
+			fmt.Fprintf(diagOut, "The value was not valid. %s\n", err.Error())
+			continue
+		}
+		if c.drawn[card] {
+			fmt.Fprintln(diagOut, "This card was already drawn since the deck was shuffled.")
+			continue
+		}
+		return c.take(card)
+	}
+}
+
+// Removes card from the deck, returns its Lehmer code digit and radix
+func (c *CardsImpl) take(card int) (int, int) {
+	digit := 0
+	for j := 0; j < card; j++ {
+		if !c.drawn[j] {
+			digit++
+		}
+	}
+	radix := c.left
+	c.drawn[card] = true
+	c.left--
+	return digit, radix
+}
+
+// Draws cards until their combined value has at least as many outcomes as
+// there are usable words n, starting anew if the value falls into
+// the incomplete range at the top (rejection sampling)
+func (c *CardsImpl) Uniform(n int) (int, error) {
+	if n == c.words {
+		c.chosen++
+		fmt.Fprintf(diagOut, "Generating word number %d:\n", c.chosen)
+	} else {
+		fmt.Fprintf(diagOut, "Choosing one of %d options for word number %d:\n", n, c.chosen)
+	}
+	for {
+		v := 0
+		outcomes := 1
+		for i := 0; outcomes < n; i++ {
+			digit, radix := c.drawCard(i)
+			v = v*radix + digit
+			outcomes = outcomes * radix
+		}
+		limit := (outcomes / n) * n
+		if v < limit {
+			return v % n, nil
+		}
+		fmt.Fprintln(diagOut, "Value out of range. Please draw more cards.")
+	}
+}
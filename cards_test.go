@@ -0,0 +1,67 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"testing"
+)
+
+type parseCard_testrecord struct {
+	card   string
+	number int
+	valid  bool
+}
+
+func TestParseCard(t *testing.T) {
+	dataset := []parseCard_testrecord{
+		parseCard_testrecord{card: "AC", number: 0, valid: true},
+		parseCard_testrecord{card: "KS", number: 51, valid: true},
+		parseCard_testrecord{card: "10h", number: 35, valid: true},
+		parseCard_testrecord{card: "Th", number: 35, valid: true},
+		parseCard_testrecord{card: " qd ", number: 24, valid: true},
+		parseCard_testrecord{card: "1S", valid: false},
+		parseCard_testrecord{card: "AX", valid: false},
+		parseCard_testrecord{card: "S", valid: false},
+	}
+	for num, testrecord := range dataset {
+		number, err := parseCard([]byte(testrecord.card))
+		if (err == nil) != testrecord.valid || (testrecord.valid && number != testrecord.number) {
+			t.Errorf("test number %d failed\n   got: %d (error %v)\n   expected: %d\n", num+1, number, err, testrecord.number)
+		}
+	}
+}
+
+// Every ordering of a small deck must produce a different value, and all
+// values must be in range, which is the property rejection sampling in
+// chooseWord relies upon
+func TestCardsLehmerDigits(t *testing.T) {
+	seen := make(map[int]bool)
+	perms := [][]int{{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}}
+	for _, perm := range perms {
+		c := new(CardsImpl)
+		c.left = CARDS_IN_DECK
+		v := 0
+		for _, card := range perm {
+			digit, radix := c.take(card)
+			v = v*radix + digit
+		}
+		if v < 0 || v >= 52*51*50 || seen[v] {
+			t.Errorf("permutation %v produced value %d that is out of range or not unique", perm, v)
+		}
+		seen[v] = true
+	}
+}
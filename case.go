@@ -0,0 +1,139 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains capitalization modes of words in passphrases. Modes that
+// mix lower and upper case forms of words need the checks for duplicates
+// and prefixes to run on both forms, as either can appear in passphrases
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// Words as they are in the wordlist
+	CaseNone = "none"
+	// First letter of every word in upper case
+	CaseFirst = "first"
+	// All letters in upper case
+	CaseAll = "all"
+	// First letter of every word but the first one in upper case
+	CaseCamel = "camel"
+	// First letter of every word in upper or lower case at random, which
+	// adds up to a bit of entropy per word
+	CaseRandom = "random"
+)
+
+var CASE_MODES = []string{CaseNone, CaseFirst, CaseAll, CaseCamel, CaseRandom}
+
+func validCaseMode(mode string) bool {
+	for _, m := range CASE_MODES {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether words appear in passphrases in both lower and upper case forms
+func caseMixesForms(mode string) bool {
+	return mode == CaseCamel || mode == CaseRandom
+}
+
+// Word with the first letter changed by to (unicode.ToUpper or
+// unicode.ToLower), in a new slice, as the letter may change its length
+func changeFirstLetter(word []byte, to func(rune) rune) []byte {
+	r, size := utf8.DecodeRune(word)
+	if r == utf8.RuneError {
+		return append([]byte(nil), word...)
+	}
+	ret := make([]byte, 0, len(word)+utf8.UTFMax)
+	ret = append(ret, string(to(r))...)
+	return append(ret, word[size:]...)
+}
+
+// Form of the word as kept in the wordlist. Modes that mix forms keep
+// the upper case form, see lowerForm for the other one
+func applyCase(word []byte, mode string) []byte {
+	switch mode {
+	case CaseFirst, CaseCamel, CaseRandom:
+		return changeFirstLetter(word, unicode.ToUpper)
+	case CaseAll:
+		return bytes.ToUpper(word)
+	}
+	return word
+}
+
+func lowerForm(word []byte) []byte {
+	return changeFirstLetter(word, unicode.ToLower)
+}
+
+// Lower case forms of all words, for modes that mix forms
+func lowerForms(words [][]byte) [][]byte {
+	ret := make([][]byte, len(words))
+	for i, word := range words {
+		ret[i] = lowerForm(word)
+	}
+	return ret
+}
+
+// Words of tracker in sorted order
+func sortedWords(tracker map[string]int) [][]byte {
+	list := make([][]byte, 0, len(tracker))
+	for word := range tracker {
+		list = append(list, []byte(word))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i], list[j]) < 0
+	})
+	return list
+}
+
+// Words the checks for duplicates and prefixes run on, and how many times
+// each occurs: words themselves, or every form of them if lower case forms
+// are given. Forms are listed once each, as the same form of one word
+// doesn't make passphrases ambiguous
+func formsToCheck(words [][]byte, dupTracker map[string]int, lower [][]byte) ([][]byte, map[string]int) {
+	if lower == nil {
+		return words, dupTracker
+	}
+	forms := make(map[string]int, 2*len(dupTracker))
+	for word, cnt := range dupTracker {
+		forms[word] = cnt
+	}
+	for _, word := range lower {
+		if _, ok := forms[string(word)]; !ok {
+			forms[string(word)] = 1
+		}
+	}
+	return sortedWords(forms), forms
+}
+
+// Bits of entropy random case adds to a word: one bit for words whose
+// two forms differ, such as those beginning with a letter, none for
+// others, weighted by how often each word is chosen
+func randomCaseEntropy(words [][]byte, lower [][]byte) float64 {
+	differ := 0
+	for i, word := range words {
+		if !bytes.Equal(word, lower[i]) {
+			differ++
+		}
+	}
+	return float64(differ) / float64(len(words))
+}
@@ -0,0 +1,94 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+type sampleCase_testrecord struct {
+	mode string
+	// Numbers the source produces, -1 stands for undo
+	numbers []int
+	pass    string
+}
+
+func TestSampleCase(t *testing.T) {
+	words := [][]byte{[]byte("alpha"), []byte("bravo"), []byte("42")}
+	dataset := []sampleCase_testrecord{
+		sampleCase_testrecord{mode: CaseNone, numbers: []int{0, 1}, pass: "alpha-bravo"},
+		sampleCase_testrecord{mode: CaseFirst, numbers: []int{0, 1}, pass: "Alpha-Bravo"},
+		sampleCase_testrecord{mode: CaseAll, numbers: []int{0, 1}, pass: "ALPHA-BRAVO"},
+		sampleCase_testrecord{mode: CaseCamel, numbers: []int{0, 1, 0}, pass: "alpha-Bravo-Alpha"},
+		// Every word is followed by its case, 0 is lower case
+		sampleCase_testrecord{mode: CaseRandom, numbers: []int{0, 1, 1, 0, 2, 1}, pass: "Alpha-bravo-42"},
+		// Undo when asked for the case discards the word
+		sampleCase_testrecord{mode: CaseRandom, numbers: []int{0, 1, 1, -1, 1, 1, 2, 0}, pass: "Alpha-Bravo-42"},
+	}
+	for num, testrecord := range dataset {
+		cased := make([][]byte, len(words))
+		for i, word := range words {
+			cased[i] = applyCase(word, testrecord.mode)
+		}
+		sampler := &Sampler{Words: cased, Delimiter: "-", Case: testrecord.mode}
+		if caseMixesForms(testrecord.mode) {
+			sampler.LowerWords = lowerForms(cased)
+		}
+		src := &scriptedSource{numbers: testrecord.numbers}
+		numWords := int64(2)
+		if testrecord.mode == CaseCamel || testrecord.mode == CaseRandom {
+			numWords = 3
+		}
+		p, err := sampler.Sample(src, numWords)
+		if err != nil || p.String() != testrecord.pass || len(src.numbers) != 0 {
+			t.Errorf("test number %d failed\n   got: %v (error %v)\n   expected: %s\n", num+1, p, err, testrecord.pass)
+		}
+	}
+}
+
+type formsToCheck_testrecord struct {
+	words []string
+	// Forms the checks run on, in order
+	forms []string
+	// Bits random case adds per word
+	caseBits float64
+}
+
+func TestFormsToCheck(t *testing.T) {
+	dataset := []formsToCheck_testrecord{
+		formsToCheck_testrecord{words: []string{"alpha", "bravo"}, forms: []string{"Alpha", "Bravo", "alpha", "bravo"}, caseBits: 1},
+		// Forms of a word that doesn't start with a letter are the same
+		formsToCheck_testrecord{words: []string{"alpha", "42"}, forms: []string{"42", "Alpha", "alpha"}, caseBits: 0.5},
+		// Letters outside ASCII change case too
+		formsToCheck_testrecord{words: []string{"Über", "Übermut"}, forms: []string{"Über", "Übermut", "über", "übermut"}, caseBits: 1},
+	}
+	for num, testrecord := range dataset {
+		dupTracker := make(map[string]int)
+		words := make([][]byte, len(testrecord.words))
+		for i, word := range testrecord.words {
+			words[i] = applyCase([]byte(word), CaseRandom)
+			dupTracker[string(words[i])]++
+		}
+		lower := lowerForms(words)
+		forms, tracker := formsToCheck(words, dupTracker, lower)
+		bits := randomCaseEntropy(words, lower)
+		if !cmpStringsToBytes(testrecord.forms, forms) || len(tracker) != len(testrecord.forms) || math.Abs(bits-testrecord.caseBits) > 1e-9 {
+			t.Errorf("test number %d failed\n   got: %q, %f bits\n   expected: %q, %f bits\n", num+1, forms, bits, testrecord.forms, testrecord.caseBits)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains choosing one of several candidate passphrases. Every choice
+// reveals something about the passphrase to whoever knows how people choose,
+// so it costs entropy: up to log2 of the number of candidates, when the
+// attacker knows exactly which candidate would be chosen
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// Entropy lost by choosing one of that many candidates
+func choiceCost(candidates int) float64 {
+	return math.Log2(float64(candidates))
+}
+
+// Shows candidates and asks which one to take. Entropy of the chosen
+// passphrase is reduced by the cost of the choice
+func chooseCandidate(candidates []*Passphrase) *Passphrase {
+	fmt.Fprintf(diagOut, "Choose one of %d passphrases:\n", len(candidates))
+	for i, p := range candidates {
+		fmt.Fprintf(diagOut, "%3d: ", i+1)
+		secret := p.Bytes()
+		diagOut.Write(secret)
+		releaseSecret(secret)
+		fmt.Fprintln(diagOut)
+	}
+	for {
+		// Choice is always typed by the user, even when rolls come from
+		// a file given by --dice-input
+		answer := readSecretLineFrom(stdinReader, fmt.Sprintf("Which one do you take (1-%d)? ", len(candidates)))
+		i, err := parseDieValue(bytes.TrimSpace(answer))
+		releaseSecret(answer)
+		if err != nil || i < 1 || i > len(candidates) {
+			fmt.Fprintf(diagOut, "Type a number from 1 to %d.\n", len(candidates))
+			continue
+		}
+		chosen := candidates[i-1]
+		chosen.Entropy = chosen.Entropy - choiceCost(len(candidates))
+		fmt.Fprintf(diagOut, "Choosing one of %d passphrases costs %.1f bits, the chosen one has %.1f bits of entropy.\n",
+			len(candidates), choiceCost(len(candidates)), chosen.Entropy)
+		return chosen
+	}
+}
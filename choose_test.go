@@ -0,0 +1,53 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+type choose_testrecord struct {
+	// What the user types
+	script  string
+	chosen  string
+	entropy float64
+}
+
+func TestChooseCandidate(t *testing.T) {
+	dataset := []choose_testrecord{
+		choose_testrecord{script: "1\n", chosen: "alpha", entropy: 40 - 2},
+		choose_testrecord{script: "4\n", chosen: "delta", entropy: 40 - 2},
+		choose_testrecord{script: "0\nfive\n5\n3\n", chosen: "charlie", entropy: 40 - 2},
+	}
+	savedStdin, savedInput := stdinReader, inputReader
+	defer func() { stdinReader, inputReader = savedStdin, savedInput }()
+	for num, testrecord := range dataset {
+		stdinReader = newSecretReader(strings.NewReader(testrecord.script))
+		// Choice is never read from --dice-input
+		inputReader = newSecretReader(strings.NewReader("2\n2\n2\n2\n"))
+		candidates := make([]*Passphrase, 0)
+		for _, word := range []string{"alpha", "bravo", "charlie", "delta"} {
+			candidates = append(candidates, &Passphrase{Words: [][]byte{[]byte(word)}, Entropy: 40})
+		}
+		p := chooseCandidate(candidates)
+		if p.String() != testrecord.chosen || math.Abs(p.Entropy-testrecord.entropy) > 1e-9 {
+			t.Errorf("test number %d failed\n   got: %s with %f bits\n   expected: %s with %f bits\n", num+1, p.String(), p.Entropy, testrecord.chosen, testrecord.entropy)
+		}
+	}
+}
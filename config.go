@@ -19,6 +19,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/pflag"
 )
@@ -28,19 +29,80 @@ type RandomSource int
 const (
 	CryptoPRNG RandomSource = iota
 	RealDice
+	Coins
+	Cards
+	ByteStream
+	Mixed
+	Seeded
+	Derived
+)
+
+// Commands other than generating a passphrase, given as the first argument
+const (
+	CommandGenerate  = ""
+	CommandDiceStats = "dice-stats"
+	CommandReplay    = "replay"
+	CommandDerive    = "derive"
 )
 
 type Config struct {
-	NumWords      int64
-	Verbosity     int
-	Entropy       float64
-	Delimiter     string
-	Capitalize    bool
+	Command     string
+	CommandArgs []string
+	NumWords    int64
+	Count       int64
+	// Number of candidates to choose the passphrase from
+	Choose int
+	// Don't generate anything if the wordlist has warnings
+	FailOnWarning bool
+	// Lock secrets in memory and keep them out of core dumps
+	Paranoid bool
+	// Where to write the passphrase without trailing newline instead of
+	// standard output: file descriptor, -1 if not given, or new file
+	OutputFd   int
+	OutputFile string
+	// FormatText or FormatJSON
+	Format    string
+	Verbosity int
+	Entropy   float64
+	Delimiter string
+	// Characters drawn at random to separate words instead of Delimiter,
+	// and to insert at a random word boundary, nil if not given
+	Delimiters []rune
+	Insert     []rune
+	// Limits on length and characters the passphrase must pass, nil if
+	// not given
+	Policy *Policy
+	// Slots of the phrase pattern, nil if words are drawn from the whole
+	// wordlist
+	Pattern []string
+	// How words are capitalized, see CaseNone and others
+	Case          string
 	WordListName  string
 	ListWordLists bool
 	DictFileName  string
 	DiceFaces     int
+	Dice          []int
+	Reroll        bool
 	RndSource     RandomSource
+	// Random source as given by the user, for reports
+	RndSourceName string
+	// File or device to read randomness from when RndSource is ByteStream,
+	// "-" stands for standard input
+	RndSourceFile string
+	// Where the seed of Seeded source comes from: "file:PATH" or "env:NAME"
+	SeedSpec    string
+	AllowSeeded bool
+	HealthTests bool
+	// Entropy of master passphrase of derive command, 0 if unknown
+	MasterEntropy float64
+	// Labels of physical dice to record face counts for, either one label
+	// for all dice or one label per die in Dice
+	DieLabels []string
+	// File with dice rolls, coin flips or cards to read instead of asking
+	// the user
+	DiceInputFile string
+	// File to write transcript of dice session into
+	TranscriptFile string
 }
 
 var sysConfig *Config = nil
@@ -62,7 +124,7 @@ func checkForMutualExclusiveFlags() {
 				if ch == ch2 {
 					a++
 					if a == 2 {
-						fmt.Printf("Parameters -%s (--%s) and -%s (--%s) are mutually exclusive.\n", prevch, shortToLong[prevch], string(ch), shortToLong[string(ch)])
+						fmt.Fprintf(diagOut, "Parameters -%s (--%s) and -%s (--%s) are mutually exclusive.\n", prevch, shortToLong[prevch], string(ch), shortToLong[string(ch)])
 						os.Exit(1)
 					} else {
 						prevch = string(ch)
@@ -76,17 +138,73 @@ func checkForMutualExclusiveFlags() {
 func configure() {
 	con := new(Config)
 	strRndSource := ""
+	strDice := ""
+	strDieLabels := ""
+	strDelimiters := ""
+	strInsert := ""
+	strPolicy := ""
+	maxLength := 0
+	strPattern := ""
 	pflag.Int64VarP(&(con.NumWords), "num", "n", 0, "Number of words to concatenate.")
+	pflag.Int64Var(&(con.Count), "count", 1, "Number of passphrases to generate. The wordlist is read and checked only once.")
+	pflag.IntVar(&(con.Choose), "choose", 1, "Show this many candidates and let you choose one. Adds words to make up for the entropy the choice costs.")
+	pflag.BoolVar(&(con.FailOnWarning), "fail-on-warning", false, "Exit without generating anything if there are warnings about the wordlist or the random source, such as words that are prefixes of others.")
+	pflag.BoolVar(&(con.Paranoid), "paranoid", false, "Lock dice rolls, master passphrase and generated passphrase in memory so that they are never swapped to disk, and disable core dumps.")
+	pflag.IntVar(&(con.OutputFd), "output-fd", -1, "Write the passphrase to this file descriptor, without trailing newline.")
+	pflag.StringVar(&(con.OutputFile), "output-file", "", "Write the passphrase to this file, without trailing newline. The file must not exist, it is created readable only by you.")
+	pflag.StringVar(&(con.Format), "format", FormatText, "Output format: \"text\", or \"json\" for one JSON object per passphrase with its words, entropy and warnings about the wordlist and the random source.")
 	pflag.Float64VarP(&(con.Entropy), "entropy", "e", 77.5, "Desired entropy, in bits.")
 	pflag.StringVarP(&(con.Delimiter), "delimiter", "d", "", "Separate words by delimiter. Empty string by default")
-	pflag.BoolVarP(&(con.Capitalize), "caps", "c", true, "Capitalize words.")
+	pflag.StringVar(&strDelimiters, "delimiters", "", "Separate words by characters drawn at random from this set, for example \"0123456789!@#\". Adds to the entropy, so fewer words may be needed.")
+	pflag.StringVar(&strPolicy, "policy", "", "Build passphrases that pass a password policy: limits on length, required character classes and forbidden characters. Either a policy file or one of built-in policies: "+strings.Join(builtinPolicyNames(), ", ")+".")
+	pflag.StringVar(&strPattern, "pattern", "", "Draw every word from a wordlist of its own, such as adj,noun,verb,noun. Slot is a tag looked up in the wordlist, whose lines must be words followed by their tags (\"badger noun\"), or file:PATH to draw the word from a wordlist file.")
+	pflag.IntVar(&maxLength, "max-length", 0, "Generate passphrases of at most this many characters, delimiters included. Entropy is counted over the passphrases that fit, so more words may be needed, and you are told if the requested entropy can't be reached.")
+	pflag.StringVar(&strInsert, "insert", "", "Insert a character drawn at random from this set at a random position between words, before the first or after the last one. Adds to the entropy, so fewer words may be needed.")
+	capitalize := true
+	pflag.BoolVarP(&capitalize, "caps", "c", true, "Capitalize words. Same as --case first, and --caps=false is the same as --case none.")
+	pflag.StringVar(&(con.Case), "case", CaseFirst, "How to capitalize words: \"none\", \"first\" letter of every word, \"all\" letters, \"camel\" (all words but the first one), or \"random\" for first letter of every word, which adds up to a bit of entropy per word.")
 	pflag.StringVarP(&(con.WordListName), "wordlist", "w", "offend_fast", "Use words from this wordlist.")
 	pflag.BoolVarP(&(con.ListWordLists), "list", "l", false, "List all the available wordlists which can be passed to -w (--wordlist) parameter")
-	pflag.StringVarP(&(strRndSource), "randomsource", "r", "system", "Get randomness from this source. Possible values: \"realdice\", \"system\".")
-	pflag.IntVarP(&(con.DiceFaces), "faces", "f", 6, "Number of faces/sides of dice, when \"realdice\" is used as source.")
+	pflag.StringVarP(&(strRndSource), "randomsource", "r", "system", "Get randomness from this source. Possible values: \"realdice\", \"coins\", \"cards\", \"mixed\" (dice and system), \"file:PATH\", \"stdin\", \"system\", or \"seeded:file:PATH\" and \"seeded:env:NAME\" for deterministic test vectors.")
+	pflag.BoolVar(&(con.AllowSeeded), "allow-seeded", false, "Allow \"seeded:\" random source, which gives the same passphrase for the same seed. Only meant for testing.")
+	pflag.BoolVar(&(con.HealthTests), "health-tests", true, "Run continuous health tests on dice, coins and random streams, aborting when the input looks stuck or biased.")
+	pflag.IntVarP(&(con.DiceFaces), "faces", "f", 6, "Number of faces/sides of dice, when \"realdice\" or \"mixed\" is used as source.")
+	pflag.StringVar(&(strDice), "dice", "", "Set of dice to roll for every word, when \"realdice\" is used as source. Example: 1d20,1d12,2d6")
+	pflag.StringVar(&(strDieLabels), "die-label", "", "Record how many times each face came up, to check with 'offend dice-stats' whether the die is biased. One label for all dice, or a label per group in --dice, such as red-d20,blue-d12,white-d6")
+	pflag.StringVar(&(con.DiceInputFile), "dice-input", "", "Read dice rolls, coin flips or cards from this file instead of typing them, one group per line as they would be typed.")
+	pflag.StringVar(&(con.TranscriptFile), "transcript", "", "Write rolls of every word and the word they chose into this file, to be checked with 'offend replay FILE [DICTIONARY]'. The file contains the passphrase.")
+	pflag.BoolVar(&(con.Reroll), "reroll", false, "Use the whole wordlist with \"realdice\", asking to reroll dice when the value is out of range, instead of using only as many words as dice can address.")
+	pflag.Float64Var(&(con.MasterEntropy), "master-entropy", 0, "Entropy of the master passphrase of 'offend derive', in bits. Derived passphrases are reported to be no stronger than that.")
 	pflag.CountVarP(&(con.Verbosity), "verbose", "v", "Be verbose. Use several times for increased verbosity.")
 	pflag.Parse()
 	ss := pflag.Args()
+	if len(ss) > 0 && ss[0] == CommandDiceStats {
+		con.Command = ss[0]
+		con.CommandArgs = ss[1:]
+		ss = nil
+	}
+	if len(ss) > 0 && ss[0] == CommandReplay {
+		if len(ss) < 2 || len(ss) > 3 {
+			fmt.Fprintln(diagOut, "Usage: offend replay TRANSCRIPT [DICTIONARY]")
+			os.Exit(1)
+		}
+		con.Command = ss[0]
+		con.CommandArgs = ss[1:2]
+		ss = ss[2:]
+	}
+	if len(ss) > 0 && ss[0] == CommandDerive {
+		if len(ss) < 2 || len(ss) > 3 {
+			fmt.Fprintln(diagOut, "Usage: offend derive LABEL [DICTIONARY]")
+			os.Exit(1)
+		}
+		if pflag.CommandLine.Changed("randomsource") {
+			fmt.Fprintln(diagOut, "Parameter -r (--randomsource) can't be used with 'offend derive'.")
+			os.Exit(1)
+		}
+		con.Command = ss[0]
+		con.CommandArgs = ss[1:2]
+		ss = ss[2:]
+	}
 	if len(ss) > 0 {
 		con.DictFileName = ss[0]
 	} else {
@@ -96,10 +214,262 @@ func configure() {
 		con.RndSource = CryptoPRNG
 	} else if strRndSource == "realdice" {
 		con.RndSource = RealDice
+	} else if strRndSource == "coins" {
+		con.RndSource = Coins
+	} else if strRndSource == "cards" {
+		con.RndSource = Cards
+	} else if strRndSource == "mixed" {
+		con.RndSource = Mixed
+	} else if strRndSource == "stdin" {
+		con.RndSource = ByteStream
+		con.RndSourceFile = "-"
+	} else if strings.HasPrefix(strRndSource, "file:") && len(strRndSource) > len("file:") {
+		con.RndSource = ByteStream
+		con.RndSourceFile = strRndSource[len("file:"):]
+	} else if strings.HasPrefix(strRndSource, "seeded:") && len(strRndSource) > len("seeded:") {
+		con.RndSource = Seeded
+		con.SeedSpec = strRndSource[len("seeded:"):]
 	} else if strRndSource != "" {
-		fmt.Printf("Unknown random source: '%s'. Should be 'realdice' or 'system' (case-sensitive)\n", strRndSource)
+		fmt.Fprintf(diagOut, "Unknown random source: '%s'. Should be 'realdice', 'coins', 'cards', 'mixed', 'file:PATH', 'stdin', 'seeded:file:PATH', 'seeded:env:NAME' or 'system' (case-sensitive)\n", strRndSource)
+		os.Exit(1)
+	}
+	con.RndSourceName = strRndSource
+	if con.Command == CommandDerive {
+		con.RndSource = Derived
+		con.RndSourceName = CommandDerive
+	}
+	if pflag.CommandLine.Changed("caps") {
+		if pflag.CommandLine.Changed("case") {
+			fmt.Fprintln(diagOut, "Parameters -c (--caps) and --case are mutually exclusive.")
+			os.Exit(1)
+		}
+		if !capitalize {
+			con.Case = CaseNone
+		}
+	}
+	if !validCaseMode(con.Case) {
+		fmt.Fprintf(diagOut, "Unknown case mode: '%s'. Should be one of %s.\n", con.Case, strings.Join(CASE_MODES, ", "))
+		os.Exit(1)
+	}
+	if con.Case == CaseRandom && con.TranscriptFile != "" {
+		fmt.Fprintln(diagOut, "Parameter --transcript can't be used with --case random.")
+		os.Exit(1)
+	}
+	if strDelimiters != "" {
+		if pflag.CommandLine.Changed("delimiter") {
+			fmt.Fprintln(diagOut, "Parameters -d (--delimiter) and --delimiters are mutually exclusive.")
+			os.Exit(1)
+		}
+		var err error
+		con.Delimiters, err = parseCharSet(strDelimiters)
+		if err != nil {
+			fmt.Fprintf(diagOut, "Invalid set of delimiters: %s.\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if strInsert != "" {
+		var err error
+		con.Insert, err = parseCharSet(strInsert)
+		if err != nil {
+			fmt.Fprintf(diagOut, "Invalid set of characters to insert: %s.\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if strPolicy != "" {
+		var err error
+		con.Policy, err = loadPolicy(strPolicy)
+		if err != nil {
+			fmt.Fprintf(diagOut, "Can't read policy %s: %s.\n", strPolicy, err.Error())
+			os.Exit(1)
+		}
+		if !con.Policy.allowsString(con.Delimiter) {
+			fmt.Fprintln(diagOut, "Delimiter has characters that the policy forbids.")
+			os.Exit(1)
+		}
+		if con.Delimiters != nil {
+			con.Delimiters = con.Policy.allowedChars(con.Delimiters)
+			if len(con.Delimiters) < 2 {
+				fmt.Fprintln(diagOut, "Policy forbids all but one of --delimiters, at least 2 must be allowed.")
+				os.Exit(1)
+			}
+		}
+		if con.Insert != nil {
+			con.Insert = con.Policy.allowedChars(con.Insert)
+			if len(con.Insert) < 2 {
+				fmt.Fprintln(diagOut, "Policy forbids all but one of --insert, at least 2 must be allowed.")
+				os.Exit(1)
+			}
+		}
+	}
+	if pflag.CommandLine.Changed("max-length") {
+		if maxLength < 1 {
+			fmt.Fprintf(diagOut, "Maximum length must be at least 1, got %d.\n", maxLength)
+			os.Exit(1)
+		}
+		// Same as a policy with nothing but the length limit
+		if con.Policy == nil {
+			con.Policy = new(Policy)
+		}
+		if con.Policy.MaxLength == 0 || maxLength < con.Policy.MaxLength {
+			con.Policy.MaxLength = maxLength
+		}
+		if con.Policy.MinLength > con.Policy.MaxLength {
+			fmt.Fprintf(diagOut, "Policy requires at least %d characters, more than --max-length %d.\n", con.Policy.MinLength, maxLength)
+			os.Exit(1)
+		}
+	}
+	if con.Policy != nil {
+		if con.Policy.MaxWords > 0 && con.NumWords > con.Policy.MaxWords {
+			fmt.Fprintf(diagOut, "Policy allows at most %d words, got %d.\n", con.Policy.MaxWords, con.NumWords)
+			os.Exit(1)
+		}
+	}
+	if strPattern != "" {
+		var err error
+		con.Pattern, err = parsePattern(strPattern)
+		if err != nil {
+			fmt.Fprintf(diagOut, "Invalid pattern: %s.\n", err.Error())
+			os.Exit(1)
+		}
+		if con.NumWords != 0 || con.Policy != nil {
+			fmt.Fprintln(diagOut, "Parameter --pattern can't be used with -n (--num), --policy or --max-length.")
+			os.Exit(1)
+		}
+		if con.RndSource == RealDice || con.RndSource == Coins || con.RndSource == Cards {
+			fmt.Fprintln(diagOut, "Parameter --pattern can't be used with \"realdice\", \"coins\" or \"cards\" random source, use \"mixed\" for dice.")
+			os.Exit(1)
+		}
+	}
+	if (con.Delimiters != nil || con.Insert != nil || con.Policy != nil) && con.TranscriptFile != "" {
+		fmt.Fprintln(diagOut, "Parameter --transcript can't be used with --delimiters, --insert, --policy or --max-length.")
+		os.Exit(1)
+	}
+	if con.Format != FormatText && con.Format != FormatJSON {
+		fmt.Fprintf(diagOut, "Unknown output format: '%s'. Should be 'text' or 'json'.\n", con.Format)
+		os.Exit(1)
+	}
+	if con.RndSource == Seeded && !con.AllowSeeded {
+		fmt.Fprintln(diagOut, "Random source \"seeded:\" is deterministic: anyone who knows the seed can recompute the passphrase.")
+		fmt.Fprintln(diagOut, "It is only meant for test vectors. Pass --allow-seeded if that is what you want.")
+		os.Exit(1)
+	}
+	if con.RndSourceFile == "-" && con.DictFileName == "-" {
+		fmt.Fprintln(diagOut, "Can't read both the dictionary and randomness from standard input.")
+		os.Exit(1)
+	}
+	if con.DiceFaces < 2 {
+		fmt.Fprintf(diagOut, "Dice must have at least 2 faces, got %d.\n", con.DiceFaces)
+		os.Exit(1)
+	}
+	if strDice != "" {
+		if pflag.CommandLine.Changed("faces") {
+			fmt.Fprintln(diagOut, "Parameters -f (--faces) and --dice are mutually exclusive.")
+			os.Exit(1)
+		}
+		if con.RndSource != RealDice && con.RndSource != Mixed {
+			fmt.Fprintln(diagOut, "Parameter --dice can only be used with \"realdice\" or \"mixed\" random source.")
+			os.Exit(1)
+		}
+		var err error
+		con.Dice, err = parseDiceSpec(strDice)
+		if err != nil {
+			fmt.Fprintf(diagOut, "Invalid dice set: %s.\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if strDieLabels != "" {
+		con.DieLabels = parseDieLabels(strDieLabels, strDice, con.Dice)
+		if con.RndSource != RealDice && con.RndSource != Coins && con.RndSource != Mixed {
+			fmt.Fprintln(diagOut, "Parameter --die-label can only be used with \"realdice\", \"coins\" or \"mixed\" random source.")
+			os.Exit(1)
+		}
+	}
+	if con.DiceInputFile != "" && con.RndSource != RealDice && con.RndSource != Coins &&
+		con.RndSource != Cards && con.RndSource != Mixed {
+		fmt.Fprintln(diagOut, "Parameter --dice-input can only be used with \"realdice\", \"coins\", \"cards\" or \"mixed\" random source.")
+		os.Exit(1)
+	}
+	if con.TranscriptFile != "" && con.RndSource != RealDice && con.RndSource != Coins {
+		fmt.Fprintln(diagOut, "Parameter --transcript can only be used with \"realdice\" or \"coins\" random source.")
+		os.Exit(1)
+	}
+	if con.Count < 1 {
+		fmt.Fprintf(diagOut, "Number of passphrases must be at least 1, got %d.\n", con.Count)
+		os.Exit(1)
+	}
+	if con.Choose < 1 {
+		fmt.Fprintf(diagOut, "Number of candidates must be at least 1, got %d.\n", con.Choose)
+		os.Exit(1)
+	}
+	if con.Choose > 1 && (con.Count > 1 || con.TranscriptFile != "" || con.Command == CommandDerive) {
+		fmt.Fprintln(diagOut, "Parameter --choose can't be used with --count, --transcript or 'offend derive'.")
+		os.Exit(1)
+	}
+	if con.Choose > 1 && (con.RndSourceFile == "-" || con.DictFileName == "-") {
+		fmt.Fprintln(diagOut, "Parameter --choose reads the choice from standard input, it can't be used when the dictionary or randomness is read from there.")
+		os.Exit(1)
+	}
+	if con.Count > 1 && con.TranscriptFile != "" {
+		fmt.Fprintln(diagOut, "Parameter --transcript can only be used for a single passphrase.")
+		os.Exit(1)
+	}
+	if con.Count > 1 && con.Command == CommandDerive {
+		fmt.Fprintln(diagOut, "Derived passphrase is always the same, parameter --count can't be used with 'offend derive'.")
+		os.Exit(1)
+	}
+	if con.Paranoid && (con.Format == FormatJSON || con.TranscriptFile != "") {
+		fmt.Fprintln(diagOut, "Parameter --paranoid can't be used with --format json or --transcript, which keep copies of the passphrase.")
+		os.Exit(1)
+	}
+	if con.OutputFd >= 0 && con.OutputFile != "" {
+		fmt.Fprintln(diagOut, "Parameters --output-fd and --output-file are mutually exclusive.")
+		os.Exit(1)
+	}
+	if pflag.CommandLine.Changed("output-fd") && con.OutputFd < 0 {
+		fmt.Fprintf(diagOut, "File descriptor can't be negative, got %d.\n", con.OutputFd)
+		os.Exit(1)
+	}
+	if con.Count > 1 && (con.OutputFd >= 0 || con.OutputFile != "") {
+		fmt.Fprintln(diagOut, "Parameters --output-fd and --output-file can only be used for a single passphrase.")
 		os.Exit(1)
 	}
 	checkForMutualExclusiveFlags()
 	sysConfig = con
 }
+
+// Expands labels given per group of --dice specification into one label
+// per die. A single label is kept as it is, and then all dice need to have
+// the same number of faces
+func parseDieLabels(strDieLabels string, strDice string, dice []int) []string {
+	labels := strings.Split(strDieLabels, ",")
+	for i := range labels {
+		labels[i] = strings.TrimSpace(labels[i])
+		if !validDieLabel(labels[i]) {
+			fmt.Fprintf(diagOut, "Invalid die label \"%s\". Use letters, digits, '.', '_' and '-'.\n", labels[i])
+			os.Exit(1)
+		}
+	}
+	if len(labels) == 1 {
+		for _, faces := range dice {
+			if faces != dice[0] {
+				fmt.Fprintln(diagOut, "Dice with different numbers of faces need a label per group in --dice.")
+				os.Exit(1)
+			}
+		}
+		return labels
+	}
+	groups := strings.Split(strDice, ",")
+	if len(groups) != len(labels) {
+		fmt.Fprintf(diagOut, "There are %d die labels for %d groups of dice in --dice.\n", len(labels), len(groups))
+		os.Exit(1)
+	}
+	perDie := make([]string, 0, len(dice))
+	for i, group := range groups {
+		// Already validated
+		groupDice, _ := parseDiceSpec(group)
+		for range groupDice {
+			perDie = append(perDie, labels[i])
+		}
+	}
+	return perDie
+}
@@ -0,0 +1,186 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains derivation of per-site passphrases from a master passphrase
+// and a label, such as site name. Nothing is stored: the same master
+// passphrase, label, wordlist and settings always give the same words
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"unicode"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/term"
+)
+
+// Separates salts of this program from any other use of Argon2id, and
+// makes sure the salt is long enough even for short labels
+const DERIVE_DOMAIN = "offend derive v1"
+
+// Argon2id parameters, the second recommended option of RFC 9106. They
+// must never change, or derived passphrases would change with them
+const (
+	DERIVE_ARGON2_TIME    = 3
+	DERIVE_ARGON2_MEMORY  = 64 * 1024 // KiB
+	DERIVE_ARGON2_THREADS = 4
+	DERIVE_KEY_LENGTH     = 32
+)
+
+// Argon2id output seeds HMAC_DRBG, and words are chosen from its stream
+// the same way as from a random stream file, see uniformFromBytes
+type DerivedImpl struct {
+	label  string
+	master []byte
+	rd     *drbgReader
+	// Argon2id parameters, tests use cheaper ones
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+func NewDerived() *DerivedImpl {
+	return &DerivedImpl{
+		time:    DERIVE_ARGON2_TIME,
+		memory:  DERIVE_ARGON2_MEMORY,
+		threads: DERIVE_ARGON2_THREADS,
+	}
+}
+
+func (d *DerivedImpl) SetLabel(label string) {
+	d.label = label
+}
+
+func (d *DerivedImpl) Usable(totalWords int) int {
+	return totalWords
+}
+
+// Asks for the master passphrase, without echo when typed on a terminal
+func (d *DerivedImpl) ReadMaster() {
+	fd := int(os.Stdin.Fd())
+	if inputReader.Buffered() == 0 && term.IsTerminal(fd) {
+		fmt.Fprint(diagOut, "Master passphrase: ")
+		master, err := term.ReadPassword(fd)
+		fmt.Fprintln(diagOut)
+		if err != nil {
+			fmt.Fprintf(diagOut, "Could not read input: %s.\n", err.Error())
+			os.Exit(ERROR_INPUT_ENDED)
+		}
+		d.master = append(newSecret(len(master)), master...)
+		wipeBytes(master)
+	} else {
+		d.master = readSecretLine("Master passphrase: ")
+	}
+	if len(d.master) == 0 {
+		fmt.Fprintln(diagOut, "Master passphrase can't be empty.")
+		os.Exit(1)
+	}
+}
+
+func (d *DerivedImpl) salt() []byte {
+	return []byte(DERIVE_DOMAIN + "\x00" + d.label)
+}
+
+// Master passphrase is not needed once the key is derived
+func (d *DerivedImpl) BeginSession(totalWords int, numWords int64, bits float64) error {
+	key := argon2.IDKey(d.master, d.salt(), d.time, d.memory, d.threads, DERIVE_KEY_LENGTH)
+	releaseSecret(d.master)
+	d.master = nil
+	d.rd = &drbgReader{drbg: newHmacDRBG(key)}
+	wipeBytes(key)
+	return nil
+}
+
+func (d *DerivedImpl) Uniform(n int) (int, error) {
+	// DRBG never runs out
+	chRand, _, _ := uniformFromBytes(d.rd, n)
+	return chRand, nil
+}
+
+func (d *DerivedImpl) EndSession(p *Passphrase) error {
+	return nil
+}
+
+// Derived passphrase can't be stronger than the master passphrase, as
+// guessing the master passphrase gives all derived ones. masterBits is
+// entropy of the master passphrase if the user knows it, 0 otherwise.
+// Returns how strong the derived passphrase is
+func (d *DerivedImpl) ReportStrength(wordsBits float64, masterBits float64) float64 {
+	estimated := masterBits <= 0
+	if estimated {
+		masterBits = secretEntropyBound(d.master)
+	}
+	if wordsBits <= masterBits {
+		fmt.Fprintf(diagOut, "Derived passphrase has %.1f bits of entropy.\n", wordsBits)
+		return wordsBits
+	}
+	if estimated {
+		fmt.Fprintf(diagOut, "Words carry %.1f bits, but the passphrase is at most as strong as the master passphrase: at most %.1f bits,\n", wordsBits, masterBits)
+		fmt.Fprintln(diagOut, "judging by its length and kinds of characters. Use --master-entropy to give its actual entropy.")
+	} else {
+		fmt.Fprintf(diagOut, "Words carry %.1f bits, but the passphrase is at most as strong as the master passphrase: %.1f bits.\n", wordsBits, masterBits)
+	}
+	addWarning(WARN_MASTER_LIMITS_STRENGTH, fmt.Sprintf("Passphrase is at most as strong as the master passphrase: %.1f bits.", masterBits))
+	return masterBits
+}
+
+// Upper bound of entropy of a secret of unknown origin: as if every
+// character was chosen at random among all characters of its kinds.
+// Secrets chosen by people have much less
+func secretEntropyBound(secret []byte) float64 {
+	var lower, upper, digit, other, nonASCII bool
+	length := 0
+	// Converting for range makes no copy of the secret
+	for _, c := range string(secret) {
+		length++
+		switch {
+		case c > unicode.MaxASCII:
+			nonASCII = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	alphabet := 0
+	if lower {
+		alphabet = alphabet + 26
+	}
+	if upper {
+		alphabet = alphabet + 26
+	}
+	if digit {
+		alphabet = alphabet + 10
+	}
+	if other {
+		// Printable ASCII symbols and space
+		alphabet = alphabet + 33
+	}
+	if nonASCII {
+		// Letters of one more alphabet
+		alphabet = alphabet + 100
+	}
+	if alphabet < 2 {
+		return 0
+	}
+	return float64(length) * math.Log2(float64(alphabet))
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+type derive_testrecord struct {
+	master string
+	label  string
+	pass   string
+}
+
+type secretEntropy_testrecord struct {
+	secret string
+	bits   float64
+}
+
+// Derives with cheap Argon2id parameters, so that tests run fast
+func cheapDerived(master string, label string) *DerivedImpl {
+	d := &DerivedImpl{master: []byte(master), time: 1, memory: 64, threads: 1}
+	d.SetLabel(label)
+	return d
+}
+
+// Golden vectors: these must never change, or derived passphrases change
+func TestDerivedGenerate(t *testing.T) {
+	words := make([][]byte, 7776)
+	for i := range words {
+		words[i] = []byte(fmt.Sprintf("%d", i))
+	}
+	dataset := []derive_testrecord{
+		derive_testrecord{master: "correct horse battery staple", label: "example.com", pass: "1009 3638 1038 3018 1405 4643"},
+		derive_testrecord{master: "correct horse battery staple", label: "example.org", pass: "1465 1687 2769 2729 1561 3647"},
+		derive_testrecord{master: "correct horse battery stapler", label: "example.com", pass: "4010 2288 3548 2757 4737 812"},
+	}
+	seen := make(map[string]bool)
+	for num, testrecord := range dataset {
+		pass := samplePassphrase(t, cheapDerived(testrecord.master, testrecord.label), words, 6, " ")
+		again := samplePassphrase(t, cheapDerived(testrecord.master, testrecord.label), words, 6, " ")
+		if pass != testrecord.pass || again != pass {
+			t.Errorf("test number %d failed\n   got: %s, then %s\n   expected: %s\n", num+1, pass, again, testrecord.pass)
+		}
+		if seen[pass] {
+			t.Errorf("test number %d failed: passphrase %s was derived before", num+1, pass)
+		}
+		seen[pass] = true
+	}
+}
+
+func TestSecretEntropyBound(t *testing.T) {
+	dataset := []secretEntropy_testrecord{
+		secretEntropy_testrecord{secret: "", bits: 0},
+		secretEntropy_testrecord{secret: "password", bits: 8 * math.Log2(26)},
+		secretEntropy_testrecord{secret: "Passw0rd", bits: 8 * math.Log2(62)},
+		secretEntropy_testrecord{secret: "correct horse", bits: 13 * math.Log2(59)},
+		secretEntropy_testrecord{secret: "1234", bits: 4 * math.Log2(10)},
+		secretEntropy_testrecord{secret: "пароль", bits: 6 * math.Log2(100)},
+	}
+	for num, testrecord := range dataset {
+		bits := secretEntropyBound([]byte(testrecord.secret))
+		if math.Abs(bits-testrecord.bits) > 1e-9 {
+			t.Errorf("test number %d failed\n   got: %f\n   expected: %f\n", num+1, bits, testrecord.bits)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains opt-in tracking of how often each face of a physical die
+// came up, accumulated across sessions. Only counts of faces are stored,
+// never the rolls in order and never the words they selected
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Subdirectory of user's configuration directory
+const DICE_STATS_DIRECTORY = "offend/dice-stats"
+
+const DICE_STATS_EXTENSION = ".stats"
+
+// Die is to be retired when the chance of a fair die showing faces this
+// unevenly is lower than that
+const DIE_RETIRE_PVALUE = 0.001
+
+// Labels become file names, so they are restricted to safe characters
+var DIE_LABEL_REGEX *regexp.Regexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func validDieLabel(label string) bool {
+	return DIE_LABEL_REGEX.MatchString(label)
+}
+
+func diceStatsDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.FromSlash(DICE_STATS_DIRECTORY)), nil
+}
+
+func diceStatsPath(label string) (string, error) {
+	dir, err := diceStatsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, label+DICE_STATS_EXTENSION), nil
+}
+
+// Reads face counts in the format written by writeDiceStats: a "faces N"
+// line followed by "FACE COUNT" lines, lines starting with # are comments
+func readDiceStats(rd io.Reader) ([]int, error) {
+	sc := bufio.NewScanner(rd)
+	var counts []int
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed line \"%s\"", line)
+		}
+		v, err := strconv.Atoi(fields[1])
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("malformed line \"%s\"", line)
+		}
+		if fields[0] == "faces" {
+			if counts != nil || v < 2 {
+				return nil, fmt.Errorf("malformed line \"%s\"", line)
+			}
+			counts = make([]int, v)
+			continue
+		}
+		face, err := strconv.Atoi(fields[0])
+		if err != nil || counts == nil || face < 1 || face > len(counts) {
+			return nil, fmt.Errorf("malformed line \"%s\"", line)
+		}
+		counts[face-1] = v
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if counts == nil {
+		return nil, fmt.Errorf("number of faces is missing")
+	}
+	return counts, nil
+}
+
+func writeDiceStats(wr io.Writer, counts []int) error {
+	bw := bufio.NewWriter(wr)
+	fmt.Fprintln(bw, "# offend dice statistics: how many times each face came up")
+	fmt.Fprintf(bw, "faces %d\n", len(counts))
+	for i, cnt := range counts {
+		fmt.Fprintf(bw, "%d %d\n", i+1, cnt)
+	}
+	return bw.Flush()
+}
+
+// Returns face counts recorded for the die, nil if nothing was recorded yet
+func loadDiceStats(label string) ([]int, error) {
+	fname, err := diceStatsPath(label)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(fname)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	counts, err := readDiceStats(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fname, err.Error())
+	}
+	return counts, nil
+}
+
+// Adds face counts of this session to the ones recorded for the die
+func addDiceStats(label string, session []int) (string, error) {
+	counts, err := loadDiceStats(label)
+	if err != nil {
+		return "", err
+	}
+	if counts == nil {
+		counts = make([]int, len(session))
+	} else if len(counts) != len(session) {
+		return "", fmt.Errorf("die \"%s\" was recorded with %d faces, not %d", label, len(counts), len(session))
+	}
+	for i, cnt := range session {
+		counts[i] = counts[i] + cnt
+	}
+	fname, err := diceStatsPath(label)
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		return "", err
+	}
+	// Write a new file and rename it over the old one, so that counts
+	// are not lost if the program is interrupted
+	tmpName := fname + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	err = writeDiceStats(f, counts)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return "", err
+	}
+	return fname, os.Rename(tmpName, fname)
+}
+
+// Prints goodness-of-fit verdict for dice with the given labels, or for all
+// dice recorded so far if no labels are given
+func PrintDiceStats(labels []string) {
+	if len(labels) == 0 {
+		dir, err := diceStatsDir()
+		if err != nil {
+			fmt.Fprintf(diagOut, "Can't locate dice statistics: %s.\n", err.Error())
+			os.Exit(1)
+		}
+		matches, _ := filepath.Glob(filepath.Join(dir, "*"+DICE_STATS_EXTENSION))
+		for _, m := range matches {
+			labels = append(labels, strings.TrimSuffix(filepath.Base(m), DICE_STATS_EXTENSION))
+		}
+		sort.Strings(labels)
+		if len(labels) == 0 {
+			fmt.Fprintf(diagOut, "No dice statistics were recorded in %s yet. Use --die-label when rolling dice to record them.\n", dir)
+			return
+		}
+	}
+	for i, label := range labels {
+		if i > 0 {
+			fmt.Println()
+		}
+		if !validDieLabel(label) {
+			fmt.Fprintf(diagOut, "Invalid die label \"%s\".\n", label)
+			continue
+		}
+		counts, err := loadDiceStats(label)
+		if err != nil {
+			fmt.Fprintf(diagOut, "Can't read statistics of die \"%s\": %s.\n", label, err.Error())
+			continue
+		}
+		if counts == nil {
+			fmt.Fprintf(diagOut, "Nothing was recorded for die \"%s\".\n", label)
+			continue
+		}
+		printDieVerdict(label, counts)
+	}
+}
+
+func printDieVerdict(label string, counts []int) {
+	total := 0
+	for _, cnt := range counts {
+		total = total + cnt
+	}
+	fmt.Printf("Die \"%s\" (d%d), %d rolls recorded.\n", label, len(counts), total)
+	for i, cnt := range counts {
+		fmt.Printf("  %2d: %d\n", i+1, cnt)
+	}
+	stat, df, pvalue, ok := chiSquareTest(counts)
+	if !ok {
+		fmt.Printf("Not enough rolls to judge yet, need at least %d.\n", CHI_SQUARE_MIN_EXPECTED*len(counts))
+		return
+	}
+	fmt.Printf("Chi-square %.2f with %d degrees of freedom, p-value %g.\n", stat, df, pvalue)
+	if pvalue < DIE_RETIRE_PVALUE {
+		fmt.Println("RETIRE this die: its faces are very unlikely to be equally probable.")
+	} else {
+		fmt.Println("No evidence of bias so far.")
+	}
+}
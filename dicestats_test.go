@@ -0,0 +1,93 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+type readDiceStats_testrecord struct {
+	input  string
+	counts []int
+	valid  bool
+}
+
+func TestReadDiceStats(t *testing.T) {
+	dataset := []readDiceStats_testrecord{
+		readDiceStats_testrecord{input: "# comment\nfaces 4\n1 3\n2 0\n3 7\n4 1\n", counts: []int{3, 0, 7, 1}, valid: true},
+		readDiceStats_testrecord{input: "faces 2\n2 5\n", counts: []int{0, 5}, valid: true},
+		readDiceStats_testrecord{input: "1 3\nfaces 4\n", valid: false},
+		readDiceStats_testrecord{input: "faces 4\n5 3\n", valid: false},
+		readDiceStats_testrecord{input: "faces 4\n1 -3\n", valid: false},
+		readDiceStats_testrecord{input: "", valid: false},
+	}
+	for num, testrecord := range dataset {
+		counts, err := readDiceStats(strings.NewReader(testrecord.input))
+		if (err == nil) != testrecord.valid || (testrecord.valid && !cmpInts(counts, testrecord.counts)) {
+			t.Errorf("test number %d failed\n   got: %v (error %v)\n   expected: %v\n", num+1, counts, err, testrecord.counts)
+		}
+		if testrecord.valid {
+			buf := new(bytes.Buffer)
+			writeDiceStats(buf, counts)
+			again, err := readDiceStats(buf)
+			if err != nil || !cmpInts(counts, again) {
+				t.Errorf("test number %d failed: counts %v do not survive writing and reading back", num+1, counts)
+			}
+		}
+	}
+}
+
+func TestAddDiceStats(t *testing.T) {
+	oldConfigHome, had := os.LookupEnv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	defer func() {
+		if had {
+			os.Setenv("XDG_CONFIG_HOME", oldConfigHome)
+		} else {
+			os.Unsetenv("XDG_CONFIG_HOME")
+		}
+	}()
+	if _, err := addDiceStats("red-d6", []int{1, 2, 3, 4, 5, 6}); err != nil {
+		t.Fatalf("could not record statistics: %s", err.Error())
+	}
+	if _, err := addDiceStats("red-d6", []int{6, 5, 4, 3, 2, 1}); err != nil {
+		t.Fatalf("could not record statistics: %s", err.Error())
+	}
+	if _, err := addDiceStats("red-d6", []int{1, 1, 1, 1}); err == nil {
+		t.Errorf("die recorded as d6 accepted counts for d4")
+	}
+	counts, err := loadDiceStats("red-d6")
+	if err != nil || !cmpInts(counts, []int{7, 7, 7, 7, 7, 7}) {
+		t.Errorf("got: %v (error %v)\n   expected: %v\n", counts, err, []int{7, 7, 7, 7, 7, 7})
+	}
+	counts, err = loadDiceStats("blue-d6")
+	if err != nil || counts != nil {
+		t.Errorf("die that was never recorded has counts %v (error %v)", counts, err)
+	}
+}
+
+func TestValidDieLabel(t *testing.T) {
+	for _, label := range []string{"red-d20", "d6", "Bob's", "../etc", ".hidden", "a/b", ""} {
+		expected := label == "red-d20" || label == "d6"
+		if validDieLabel(label) != expected {
+			t.Errorf("label \"%s\": got %t, expected %t", label, !expected, expected)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains fast uniform sampling from the operating system's
+// cryptographic random number generator, for generating passphrases
+// in bulk
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"math/bits"
+)
+
+// How many bytes to read from the operating system at once
+const RAND_BUFFER_SIZE = 4096
+
+// Reads random 64-bit numbers from rd, which is read in blocks of
+// RAND_BUFFER_SIZE bytes rather than once per number
+type bufferedRandReader struct {
+	rd  io.Reader
+	buf []byte
+	pos int
+}
+
+func newBufferedRandReader(rd io.Reader) *bufferedRandReader {
+	buf := make([]byte, RAND_BUFFER_SIZE)
+	return &bufferedRandReader{rd: rd, buf: buf, pos: len(buf)}
+}
+
+func newSystemRandReader() *bufferedRandReader {
+	return newBufferedRandReader(rand.Reader)
+}
+
+func (b *bufferedRandReader) Uint64() (uint64, error) {
+	if b.pos+8 > len(b.buf) {
+		if _, err := io.ReadFull(b.rd, b.buf); err != nil {
+			return 0, err
+		}
+		b.pos = 0
+	}
+	v := binary.LittleEndian.Uint64(b.buf[b.pos:])
+	// Used bytes are not needed anymore
+	for i := b.pos; i < b.pos+8; i++ {
+		b.buf[i] = 0
+	}
+	b.pos = b.pos + 8
+	return v, nil
+}
+
+// Returns uniformly distributed number in [0, n) using Lemire's method:
+// the upper half of the 128-bit product of a random 64-bit number and n
+// is in range, and products whose lower half falls below 2^64 mod n are
+// rejected, as their upper halves would make some numbers more likely.
+// See "Fast Random Integer Generation in an Interval", Daniel Lemire, 2019
+func uniformLemire(b *bufferedRandReader, n uint64) (uint64, error) {
+	x, err := b.Uint64()
+	if err != nil {
+		return 0, err
+	}
+	hi, lo := bits.Mul64(x, n)
+	if lo < n {
+		// 2^64 mod n, computed without 128-bit arithmetic
+		threshold := -n % n
+		for lo < threshold {
+			x, err = b.Uint64()
+			if err != nil {
+				return 0, err
+			}
+			hi, lo = bits.Mul64(x, n)
+		}
+	}
+	return hi, nil
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+type uniformLemire_testrecord struct {
+	n uint64
+	// Random numbers the reader returns, in order
+	xs    []uint64
+	value uint64
+	// How many of xs are used
+	used int
+}
+
+// Reader that returns the given 64-bit numbers
+func uint64Reader(xs []uint64) *bufferedRandReader {
+	buf := make([]byte, 8*len(xs))
+	for i, x := range xs {
+		binary.LittleEndian.PutUint64(buf[8*i:], x)
+	}
+	b := newBufferedRandReader(bytes.NewReader(buf))
+	b.buf = make([]byte, len(buf))
+	b.pos = len(buf)
+	return b
+}
+
+func TestUniformLemire(t *testing.T) {
+	dataset := []uniformLemire_testrecord{
+		// Upper half of x*n
+		uniformLemire_testrecord{n: 6, xs: []uint64{1<<63 + 1}, value: 3, used: 1},
+		// 2^64 mod 6 = 4, and lower half of 2^63 * 6 is 0
+		uniformLemire_testrecord{n: 6, xs: []uint64{1 << 63, 1<<62 + 1}, value: 1, used: 2},
+		uniformLemire_testrecord{n: 6, xs: []uint64{1<<64 - 1}, value: 5, used: 1},
+		// 2^64 mod 3 = 1, so lower half 0 is rejected
+		uniformLemire_testrecord{n: 3, xs: []uint64{0, 1 << 63}, value: 1, used: 2},
+		// Lower half below n but not below threshold is accepted
+		uniformLemire_testrecord{n: 3, xs: []uint64{0, 0, 1}, value: 0, used: 3},
+		// 2^64 mod 7776 = 4096, and 1 * 7776 is above it
+		uniformLemire_testrecord{n: 7776, xs: []uint64{1}, value: 0, used: 1},
+		// Powers of two never reject
+		uniformLemire_testrecord{n: 1 << 13, xs: []uint64{0}, value: 0, used: 1},
+	}
+	for num, testrecord := range dataset {
+		b := uint64Reader(testrecord.xs)
+		v, err := uniformLemire(b, testrecord.n)
+		used := b.pos / 8
+		if err != nil || v != testrecord.value || used != testrecord.used {
+			t.Errorf("test number %d failed\n   got: %d after %d numbers (error %v)\n   expected: %d after %d numbers\n", num+1, v, used, err, testrecord.value, testrecord.used)
+		}
+	}
+}
+
+// Counts of n outcomes among samples from uniform
+func uniformCounts(t *testing.T, n int, samples int, uniform func(n int) (int, error)) []int {
+	counts := make([]int, n)
+	for i := 0; i < samples; i++ {
+		v, err := uniform(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[v]++
+	}
+	return counts
+}
+
+// The fast path must be distributed the same as crypto/rand.Int: both
+// uniform, and the same as each other by chi-square test of homogeneity.
+// Threshold is low, so that the test fails only if something is wrong
+func TestUniformLemireDistribution(t *testing.T) {
+	const samples = 200000
+	const threshold = 1e-6
+	for _, n := range []int{2, 6, 7, 1000, 7776} {
+		fast := uniformCounts(t, n, samples, new(CryptoPRNGImpl).Uniform)
+		reference := uniformCounts(t, n, samples, func(n int) (int, error) {
+			v, err := cRand_UInt(uint(n))
+			return int(v), err
+		})
+		for name, counts := range map[string][]int{"uniformLemire": fast, "cRand_UInt": reference} {
+			if _, _, pvalue, ok := chiSquareTest(counts); !ok || pvalue < threshold {
+				t.Errorf("%s with %d outcomes does not look uniform, p-value %g", name, n, pvalue)
+			}
+		}
+		stat := 0.0
+		for i := range fast {
+			if sum := fast[i] + reference[i]; sum > 0 {
+				diff := float64(fast[i] - reference[i])
+				stat = stat + diff*diff/float64(sum)
+			}
+		}
+		if pvalue := chiSquarePValue(stat, n-1); pvalue < threshold {
+			t.Errorf("uniformLemire and cRand_UInt with %d outcomes are distributed differently, p-value %g", n, pvalue)
+		}
+	}
+}
+
+func BenchmarkCRandUInt(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		cRand_UInt(7776)
+	}
+}
+
+func BenchmarkUniformLemire(b *testing.B) {
+	rd := newSystemRandReader()
+	for i := 0; i < b.N; i++ {
+		uniformLemire(rd, 7776)
+	}
+}
+
+// Whole passphrases of 6 words out of 7776
+func BenchmarkSampleSystem(b *testing.B) {
+	words := make([][]byte, 7776)
+	for i := range words {
+		words[i] = []byte(fmt.Sprintf("%d", i))
+	}
+	sampler := &Sampler{Words: words, Delimiter: " "}
+	src := new(CryptoPRNGImpl)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if p, err := sampler.Sample(src, 6); err != nil || p.String() == "" {
+			b.Fatal("no passphrase")
+		}
+	}
+}
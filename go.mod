@@ -4,5 +4,7 @@ go 1.15
 
 require (
 	github.com/spf13/pflag v1.0.5
+	golang.org/x/crypto v0.8.0
+	golang.org/x/term v0.7.0
 	golang.org/x/text v0.9.0
 )
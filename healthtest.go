@@ -0,0 +1,242 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains continuous health tests for sources of randomness other than
+// the operating system's: the repetition count test and the adaptive
+// proportion test from NIST SP 800-90B, section 4.4, and a chi-square
+// goodness-of-fit test of how often each outcome occurred
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Probability of a false alarm per sample, as log2. SP 800-90B recommends
+// between 2^-20 and 2^-40
+const HEALTH_TEST_ALPHA_LOG2 = -20
+
+// Chi-square test reports bias below this p-value
+const CHI_SQUARE_PVALUE_THRESHOLD = 0.001
+
+// Chi-square test is not reliable unless every outcome is expected to occur
+// at least that many times
+const CHI_SQUARE_MIN_EXPECTED = 5
+
+type HealthTests struct {
+	outcomes int
+	// Repetition count test
+	rctCutoff  int
+	lastSample int
+	repeats    int
+	// Adaptive proportion test
+	aptWindow int
+	aptCutoff int
+	aptFirst  int
+	aptCount  int
+	aptSeen   int
+	// For chi-square test
+	counts []int
+}
+
+// Health tests for a source with this number of equally likely outcomes.
+// Min-entropy per sample is assumed to be full, log2(outcomes), as is
+// expected of fair dice or a good hardware generator
+func NewHealthTests(outcomes int) *HealthTests {
+	h := &HealthTests{outcomes: outcomes, lastSample: -1, aptFirst: -1}
+	minEntropy := math.Log2(float64(outcomes))
+	h.rctCutoff = 1 + int(math.Ceil(-HEALTH_TEST_ALPHA_LOG2/minEntropy))
+	if outcomes == 2 {
+		h.aptWindow = 1024
+	} else {
+		h.aptWindow = 512
+	}
+	h.aptCutoff = 1 + critBinom(h.aptWindow, 1.0/float64(outcomes), 1.0-math.Exp2(HEALTH_TEST_ALPHA_LOG2))
+	h.counts = make([]int, outcomes)
+	return h
+}
+
+// Feeds one sample in range [0, outcomes) to the tests. Returns error
+// if the source looks stuck or biased
+func (h *HealthTests) Feed(sample int) error {
+	h.counts[sample]++
+
+	if sample == h.lastSample {
+		h.repeats++
+		if h.repeats >= h.rctCutoff {
+			return fmt.Errorf("the same value was repeated %d times in a row", h.repeats)
+		}
+	} else {
+		h.lastSample = sample
+		h.repeats = 1
+	}
+
+	if h.aptFirst < 0 {
+		h.aptFirst = sample
+		h.aptCount = 1
+		h.aptSeen = 1
+		return nil
+	}
+	if sample == h.aptFirst {
+		h.aptCount++
+		if h.aptCount >= h.aptCutoff {
+			return fmt.Errorf("the same value occured %d times within %d values", h.aptCount, h.aptWindow)
+		}
+	}
+	h.aptSeen++
+	if h.aptSeen == h.aptWindow {
+		h.aptFirst = -1
+	}
+	return nil
+}
+
+// Returns chi-square statistic of outcome frequencies, its degrees of freedom
+// and p-value. Returns false if there are not enough samples yet for the test
+// to be meaningful
+func (h *HealthTests) ChiSquare() (float64, int, float64, bool) {
+	return chiSquareTest(h.counts)
+}
+
+// Chi-square goodness-of-fit test of counts against uniform distribution,
+// see HealthTests.ChiSquare
+func chiSquareTest(counts []int) (float64, int, float64, bool) {
+	total := 0
+	for _, cnt := range counts {
+		total = total + cnt
+	}
+	expected := float64(total) / float64(len(counts))
+	if expected < CHI_SQUARE_MIN_EXPECTED {
+		return 0, 0, 0, false
+	}
+	stat := 0.0
+	for _, cnt := range counts {
+		diff := float64(cnt) - expected
+		stat = stat + diff*diff/expected
+	}
+	df := len(counts) - 1
+	return stat, df, chiSquarePValue(stat, df), true
+}
+
+// Prints a warning if outcome frequencies look biased. The source is named
+// in the warning, e.g. "d6 dice"
+func (h *HealthTests) WarnIfBiased(name string) {
+	stat, df, pvalue, ok := h.ChiSquare()
+	if ok && pvalue < CHI_SQUARE_PVALUE_THRESHOLD {
+		fmt.Fprintf(diagOut, "Warning: values from %s look biased (chi-square %.2f with %d degrees of freedom, p-value %g).\n", name, stat, df, pvalue)
+		addWarning(WARN_SOURCE_BIASED, fmt.Sprintf("Values from %s look biased.", name))
+	}
+}
+
+// Reader that feeds every byte read to health tests, and fails
+// when they do
+type healthCheckedReader struct {
+	rd    io.Reader
+	tests *HealthTests
+}
+
+// The byte that failed the tests is not counted as read, so that
+// io.ReadFull can't mistake the read for a complete one and drop the error
+func (hr *healthCheckedReader) Read(p []byte) (int, error) {
+	n, err := hr.rd.Read(p)
+	for i := 0; i < n; i++ {
+		if herr := hr.tests.Feed(int(p[i])); herr != nil {
+			return i, &HealthTestError{herr}
+		}
+	}
+	return n, err
+}
+
+type HealthTestError struct {
+	err error
+}
+
+func (e *HealthTestError) Error() string {
+	return "health test failed: " + e.err.Error()
+}
+
+// Smallest k such that probability of at most k successes in n trials,
+// each with probability p, is at least q. This is CRITBINOM function used
+// by SP 800-90B to compute cutoff for adaptive proportion test
+func critBinom(n int, p float64, q float64) int {
+	cdf := 0.0
+	for k := 0; k <= n; k++ {
+		cdf = cdf + binomialPMF(n, k, p)
+		if cdf >= q {
+			return k
+		}
+	}
+	return n
+}
+
+func binomialPMF(n int, k int, p float64) float64 {
+	lgn, _ := math.Lgamma(float64(n + 1))
+	lgk, _ := math.Lgamma(float64(k + 1))
+	lgnk, _ := math.Lgamma(float64(n - k + 1))
+	logPMF := lgn - lgk - lgnk + float64(k)*math.Log(p) + float64(n-k)*math.Log1p(-p)
+	return math.Exp(logPMF)
+}
+
+// Probability that chi-square distributed value with df degrees of freedom
+// is at least stat, the upper regularized incomplete gamma function Q(df/2, stat/2)
+func chiSquarePValue(stat float64, df int) float64 {
+	return upperRegularizedGamma(float64(df)/2, stat/2)
+}
+
+// Computed by series expansion for x < a+1, by continued fraction otherwise
+// (Numerical Recipes, section 6.2)
+func upperRegularizedGamma(a float64, x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	lga, _ := math.Lgamma(a)
+	if x < a+1 {
+		sum := 1.0 / a
+		term := sum
+		for n := 1; n < 1000; n++ {
+			term = term * x / (a + float64(n))
+			sum = sum + term
+			if math.Abs(term) < math.Abs(sum)*1e-15 {
+				break
+			}
+		}
+		return 1 - sum*math.Exp(-x+a*math.Log(x)-lga)
+	}
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1; i < 1000; i++ {
+		an := -float64(i) * (float64(i) - a)
+		b = b + 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h = h * del
+		if math.Abs(del-1) < 1e-15 {
+			break
+		}
+	}
+	return math.Exp(-x+a*math.Log(x)-lga) * h
+}
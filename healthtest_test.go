@@ -0,0 +1,148 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+)
+
+type healthCutoffs_testrecord struct {
+	outcomes  int
+	rctCutoff int
+	aptCutoff int
+}
+
+type chiSquarePValue_testrecord struct {
+	stat   float64
+	df     int
+	pvalue float64
+}
+
+// Cutoffs for alpha = 2^-20 are listed in SP 800-90B, section 4.4
+func TestHealthTestCutoffs(t *testing.T) {
+	dataset := []healthCutoffs_testrecord{
+		healthCutoffs_testrecord{outcomes: 2, rctCutoff: 21, aptCutoff: 589},
+		healthCutoffs_testrecord{outcomes: 4, rctCutoff: 11, aptCutoff: 177},
+		healthCutoffs_testrecord{outcomes: 256, rctCutoff: 4, aptCutoff: 13},
+	}
+	for num, testrecord := range dataset {
+		h := NewHealthTests(testrecord.outcomes)
+		if h.rctCutoff != testrecord.rctCutoff || h.aptCutoff != testrecord.aptCutoff {
+			t.Errorf("test number %d failed\n   got: %d, %d\n   expected: %d, %d\n", num+1, h.rctCutoff, h.aptCutoff, testrecord.rctCutoff, testrecord.aptCutoff)
+		}
+	}
+}
+
+func TestRepetitionCountTest(t *testing.T) {
+	h := NewHealthTests(6)
+	for i := 1; i < h.rctCutoff; i++ {
+		if err := h.Feed(5); err != nil {
+			t.Fatalf("failed too early, after %d repeats: %s", i, err.Error())
+		}
+	}
+	if err := h.Feed(5); err == nil {
+		t.Errorf("did not fail after %d repeats", h.rctCutoff)
+	}
+}
+
+func TestAdaptiveProportionTest(t *testing.T) {
+	h := NewHealthTests(6)
+	// 0 1 0 2 0 3 ... never repeats, but is heavily biased towards 0
+	var err error
+	i := 0
+	for ; i < h.aptWindow && err == nil; i++ {
+		if i%2 == 0 {
+			err = h.Feed(0)
+		} else {
+			err = h.Feed(1 + (i/2)%5)
+		}
+	}
+	if err == nil {
+		t.Errorf("biased input was not detected within window of %d", h.aptWindow)
+	}
+
+	// A fair sequence must pass
+	h = NewHealthTests(6)
+	for i := 0; i < 6000; i++ {
+		if err := h.Feed((i*5 + i/6) % 6); err != nil {
+			t.Fatalf("fair input failed at sample %d: %s", i, err.Error())
+		}
+	}
+}
+
+func TestChiSquarePValue(t *testing.T) {
+	// Critical values from chi-square distribution tables
+	dataset := []chiSquarePValue_testrecord{
+		chiSquarePValue_testrecord{stat: 3.841, df: 1, pvalue: 0.05},
+		chiSquarePValue_testrecord{stat: 11.070, df: 5, pvalue: 0.05},
+		chiSquarePValue_testrecord{stat: 20.515, df: 5, pvalue: 0.001},
+		chiSquarePValue_testrecord{stat: 30.144, df: 19, pvalue: 0.05},
+		chiSquarePValue_testrecord{stat: 0, df: 5, pvalue: 1},
+	}
+	for num, testrecord := range dataset {
+		pvalue := chiSquarePValue(testrecord.stat, testrecord.df)
+		if math.Abs(pvalue-testrecord.pvalue) > testrecord.pvalue*0.01 {
+			t.Errorf("test number %d failed\n   got: %g\n   expected: %g\n", num+1, pvalue, testrecord.pvalue)
+		}
+	}
+}
+
+func TestHealthCheckedReader(t *testing.T) {
+	hr := &healthCheckedReader{rd: bytes.NewReader(make([]byte, 16)), tests: NewHealthTests(256)}
+	var err error
+	for i := 0; i < 8 && err == nil; i++ {
+		_, _, err = uniformFromBytes(hr, 7776)
+	}
+	if _, ok := err.(*HealthTestError); !ok {
+		t.Errorf("stream of zeroes was not stopped by health tests, got error %v", err)
+	}
+}
+
+type warnIfBiased_testrecord struct {
+	counts []int
+	codes  []string
+}
+
+// Bias is reported as a warning with a code, once however many times the
+// same source is found biased
+func TestWarnIfBiased(t *testing.T) {
+	dataset := []warnIfBiased_testrecord{
+		warnIfBiased_testrecord{counts: []int{100, 100, 100, 100, 100, 100}, codes: []string{}},
+		warnIfBiased_testrecord{counts: []int{100, 100, 100, 100, 100, 300}, codes: []string{WARN_SOURCE_BIASED}},
+	}
+	savedOut, savedWarnings := diagOut, reportedWarnings
+	defer func() { diagOut, reportedWarnings = savedOut, savedWarnings }()
+	diagOut = ioutil.Discard
+	for num, testrecord := range dataset {
+		reportedWarnings = make([]Warning, 0)
+		h := NewHealthTests(len(testrecord.counts))
+		copy(h.counts, testrecord.counts)
+		h.WarnIfBiased("d6 dice")
+		h.WarnIfBiased("d6 dice")
+		codes := make([]string, 0)
+		for _, w := range reportedWarnings {
+			codes = append(codes, w.Code)
+		}
+		if strings.Join(codes, ",") != strings.Join(testrecord.codes, ",") {
+			t.Errorf("test number %d failed\n   got: %v\n   expected: %v\n", num+1, codes, testrecord.codes)
+		}
+	}
+}
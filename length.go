@@ -0,0 +1,160 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains counting of passphrases by their length, so that entropy of
+// passphrases that fit length limits is known exactly
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"math"
+	"math/big"
+	"unicode/utf8"
+)
+
+// Words grouped by their length in characters. Changing case doesn't
+// change the number of characters, so all forms of a word have one length
+type lengthHistogram struct {
+	// Number of words of every length
+	words []int64
+	// Sum of log2 of how many times the word occurs in the list, over words
+	// of every length
+	repeatBits []float64
+	// Number of words of every length whose lower and upper case forms
+	// differ, nil if case is not random
+	twoForms []int64
+}
+
+// Histogram of words, lower is nil unless case is random
+func newLengthHistogram(words [][]byte, lower [][]byte) *lengthHistogram {
+	repeats := make(map[string]int)
+	maxLen := 0
+	for _, word := range words {
+		repeats[string(word)]++
+		if n := utf8.RuneCount(word); n > maxLen {
+			maxLen = n
+		}
+	}
+	h := &lengthHistogram{
+		words:      make([]int64, maxLen+1),
+		repeatBits: make([]float64, maxLen+1),
+	}
+	if lower != nil {
+		h.twoForms = make([]int64, maxLen+1)
+	}
+	for i, word := range words {
+		n := utf8.RuneCount(word)
+		h.words[n]++
+		h.repeatBits[n] = h.repeatBits[n] + math.Log2(float64(repeats[string(word)]))
+		if lower != nil && string(lower[i]) != string(word) {
+			h.twoForms[n]++
+		}
+	}
+	return h
+}
+
+// Length of the shortest word
+func (h *lengthHistogram) shortest() int {
+	for n, cnt := range h.words {
+		if cnt != 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// Numbers of sequences of numWords-1 and numWords words by their total
+// length, up to maxTotal
+func (h *lengthHistogram) sequences(numWords int64, maxTotal int) ([]*big.Int, []*big.Int) {
+	prev := make([]*big.Int, maxTotal+1)
+	last := make([]*big.Int, maxTotal+1)
+	for s := range last {
+		last[s] = new(big.Int)
+	}
+	last[0].SetInt64(1)
+	term := new(big.Int)
+	for k := int64(0); k < numWords; k++ {
+		prev, last = last, prev
+		for s := range last {
+			last[s] = new(big.Int)
+			for n := 0; n < len(h.words) && n <= s; n++ {
+				if h.words[n] != 0 && prev[s-n].Sign() != 0 {
+					term.SetInt64(h.words[n])
+					last[s].Add(last[s], term.Mul(term, prev[s-n]))
+				}
+			}
+		}
+	}
+	return prev, last
+}
+
+func log2Big(x *big.Int) float64 {
+	mant := new(big.Float)
+	exp := new(big.Float).SetInt(x).MantExp(mant)
+	m, _ := mant.Float64()
+	return float64(exp) + math.Log2(m)
+}
+
+// Entropy of numWords words chosen uniformly among the sequences whose
+// total length is within [lo, hi], and log2 of the fraction of all
+// sequences that are. Each word is one of the sequences' words equally
+// often, so the expected repeats and case forms of a word are those of
+// any single one of them. Returns false if no sequence fits
+func (h *lengthHistogram) entropy(numWords int64, lo int, hi int) (float64, float64, bool) {
+	if lo < 0 {
+		lo = 0
+	}
+	if longest := int(numWords) * (len(h.words) - 1); hi > longest {
+		hi = longest
+	}
+	if numWords < 1 || hi < lo {
+		return 0, 0, false
+	}
+	prev, last := h.sequences(numWords, hi)
+	fitting := new(big.Int)
+	for s := lo; s <= hi; s++ {
+		fitting.Add(fitting, last[s])
+	}
+	if fitting.Sign() == 0 {
+		return 0, 0, false
+	}
+	// Sequences that a word of length n can be the first word of
+	repeatBits := new(big.Float)
+	twoForms := new(big.Float)
+	completions := new(big.Int)
+	for n := 0; n < len(h.words); n++ {
+		completions.SetInt64(0)
+		for s := lo; s <= hi; s++ {
+			if s >= n {
+				completions.Add(completions, prev[s-n])
+			}
+		}
+		c := new(big.Float).SetInt(completions)
+		repeatBits.Add(repeatBits, new(big.Float).Mul(c, big.NewFloat(h.repeatBits[n])))
+		if h.twoForms != nil {
+			twoForms.Add(twoForms, new(big.Float).Mul(c, new(big.Float).SetInt64(h.twoForms[n])))
+		}
+	}
+	total := new(big.Float).SetInt(fitting)
+	perWordRepeat, _ := repeatBits.Quo(repeatBits, total).Float64()
+	perWordCase, _ := twoForms.Quo(twoForms, total).Float64()
+	bits := log2Big(fitting) + float64(numWords)*(perWordCase-perWordRepeat)
+	allWords := int64(0)
+	for _, cnt := range h.words {
+		allWords = allWords + cnt
+	}
+	share := log2Big(fitting) - float64(numWords)*math.Log2(float64(allWords))
+	return bits, share, true
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+type lengthEntropy_testrecord struct {
+	words      []string
+	randomCase bool
+	numWords   int64
+	lo         int
+	hi         int
+	bits       float64
+	share      float64
+	ok         bool
+}
+
+func TestLengthEntropy(t *testing.T) {
+	dataset := []lengthEntropy_testrecord{
+		// Pairs of at most 5 characters: 2+2, 2+3 and 3+2
+		lengthEntropy_testrecord{words: []string{"ab", "cd", "efg"}, numWords: 2, hi: 5,
+			bits: math.Log2(8), share: math.Log2(8.0 / 9), ok: true},
+		lengthEntropy_testrecord{words: []string{"ab", "cd", "efg"}, numWords: 2, lo: 6, hi: 6,
+			bits: 0, share: math.Log2(1.0 / 9), ok: true},
+		lengthEntropy_testrecord{words: []string{"ab", "cd", "efg"}, numWords: 2, lo: 7, hi: 9, ok: false},
+		// Repeated word: of 9 fitting sequences 4 are "ab ab", 2 are "ab cd",
+		// 2 are "cd ab" and 1 is "cd cd"
+		lengthEntropy_testrecord{words: []string{"ab", "ab", "cd", "efg"}, numWords: 2, hi: 4,
+			bits:  -(4.0/9)*math.Log2(4.0/9) - (4.0/9)*math.Log2(2.0/9) - (1.0/9)*math.Log2(1.0/9),
+			share: math.Log2(9.0 / 16), ok: true},
+		// Case of "42" can't be told
+		lengthEntropy_testrecord{words: []string{"Ab", "42", "Efg"}, randomCase: true, numWords: 2, hi: 4,
+			bits: 2 + 1, share: math.Log2(4.0 / 9), ok: true},
+	}
+	for num, testrecord := range dataset {
+		words := make([][]byte, len(testrecord.words))
+		for i, word := range testrecord.words {
+			words[i] = []byte(word)
+		}
+		var lower [][]byte
+		if testrecord.randomCase {
+			lower = lowerForms(words)
+		}
+		h := newLengthHistogram(words, lower)
+		bits, share, ok := h.entropy(testrecord.numWords, testrecord.lo, testrecord.hi)
+		if ok != testrecord.ok || (ok && (math.Abs(bits-testrecord.bits) > 1e-9 || math.Abs(share-testrecord.share) > 1e-9)) {
+			t.Errorf("test number %d failed\n   got: %f bits, share %f, %v\n   expected: %f bits, share %f, %v\n",
+				num+1, bits, share, ok, testrecord.bits, testrecord.share, testrecord.ok)
+		}
+	}
+}
+
+func TestSampleLengthLimits(t *testing.T) {
+	words := [][]byte{[]byte("ab"), []byte("cd"), []byte("efgh")}
+	sampler := &Sampler{Words: words, Delimiter: "-", MinWordsLength: 5, MaxWordsLength: 6}
+	// Words "efgh efgh" are too long as soon as the second one is chosen,
+	// and "ab cd" are too short
+	src := &scriptedSource{numbers: []int{2, 2, 0, 1, 1, 2}}
+	p, err := sampler.Sample(src, 2)
+	if err != nil || p.String() != "cd-efgh" || len(src.numbers) != 0 {
+		t.Errorf("got: %v (error %v)\n", p, err)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains random source that mixes dice rolls with bytes from
+// the operating system's cryptographic random number generator, so that
+// the passphrase stays secure as long as either of them is
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Separates hashes computed by this program from any other use of SHA-512
+const MIXED_DOMAIN = "offend mixed random source v1"
+
+// How many bytes to take from the operating system
+const MIXED_SYSTEM_BYTES = 32
+
+// How many dice to type at once when all dice are the same
+const MIXED_DICE_PER_GROUP = 5
+
+// Dice rolls and system bytes are hashed together with SHA-512 into a seed,
+// and words are chosen from a stream of bytes expanded from that seed.
+// Dice are rolled until they alone provide as much entropy as
+// the passphrase needs
+type MixedImpl struct {
+	roller    RealDiceImpl
+	verbosity int
+	// Set up by BeginSession
+	dice       []int
+	bitsNeeded float64
+	expander   *hashExpander
+}
+
+func (m *MixedImpl) SetDiceFaces(faces int) {
+	m.roller.SetDiceFaces(faces)
+}
+
+func (m *MixedImpl) SetDice(dice []int) {
+	m.roller.SetDice(dice)
+}
+
+func (m *MixedImpl) SetDieLabels(labels []string) {
+	m.roller.SetDieLabels(labels)
+}
+
+func (m *MixedImpl) SetHealthTests(enabled bool) {
+	m.roller.SetHealthTests(enabled)
+}
+
+func (m *MixedImpl) SetVerbosity(verbosity int) {
+	m.verbosity = verbosity
+}
+
+// Words are chosen from the expanded stream, which can address any number
+// of words
+func (m *MixedImpl) Usable(totalWords int) int {
+	return totalWords
+}
+
+// Dice to roll, in order, so that their entropy is at least bits
+func (m *MixedImpl) diceToRoll(bits float64) []int {
+	set := m.roller.dice
+	if set == nil {
+		set = []int{m.roller.faces}
+	}
+	dice := make([]int, 0)
+	total := 0.0
+	for i := 0; total < bits; i++ {
+		faces := set[i%len(set)]
+		dice = append(dice, faces)
+		total = total + math.Log2(float64(faces))
+	}
+	return dice
+}
+
+// Dice are typed in groups: the whole dice set at once, or a few dice of
+// the same kind
+func (m *MixedImpl) diceGroupSize() int {
+	if m.roller.dice != nil {
+		return len(m.roller.dice)
+	}
+	return MIXED_DICE_PER_GROUP
+}
+
+// Stream of bytes expanded from a seed: SHA-256 of the seed followed by
+// 64-bit big endian block counter, for each block in turn
+type hashExpander struct {
+	seed    []byte
+	counter uint64
+	block   []byte
+}
+
+func (h *hashExpander) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(h.block) == 0 {
+			var ctr [8]byte
+			binary.BigEndian.PutUint64(ctr[:], h.counter)
+			h.counter++
+			hasher := sha256.New()
+			hasher.Write(h.seed)
+			hasher.Write(ctr[:])
+			h.block = hasher.Sum(nil)
+		}
+		copied := copy(p[n:], h.block)
+		h.block = h.block[copied:]
+		n = n + copied
+	}
+	return n, nil
+}
+
+// Hashes dice rolls together with system bytes. Every roll is encoded
+// along with the number of faces of its die, so that different sequences
+// of rolls can't produce the same input to the hash
+func mixSeed(dice []int, rolls []int, system []byte) []byte {
+	hasher := sha512.New()
+	hasher.Write([]byte(MIXED_DOMAIN))
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(len(rolls)))
+	hasher.Write(buf[:])
+	for i, rolled := range rolls {
+		binary.BigEndian.PutUint32(buf[:4], uint32(dice[i]))
+		binary.BigEndian.PutUint32(buf[4:], uint32(rolled))
+		hasher.Write(buf[:])
+	}
+	hasher.Write(system)
+	return hasher.Sum(nil)
+}
+
+// Dice are rolled for all bits of the passphrase: random case, delimiters
+// and other characters are drawn from the same stream as words
+func (m *MixedImpl) BeginSession(totalWords int, numWords int64, bits float64) error {
+	m.bitsNeeded = bits
+	dice := m.diceToRoll(m.bitsNeeded)
+	fmt.Fprintf(diagOut, "Rolling %d dice to mix with system randomness.\n", len(dice))
+	fmt.Fprintln(diagOut, "Type \"undo\" instead of values to roll the previous group of dice again.")
+	group := m.diceGroupSize()
+	rolls := make([]int, 0, len(dice))
+	for len(rolls) < len(dice) {
+		end := len(rolls) + group
+		if end > len(dice) {
+			end = len(dice)
+		}
+		typed := m.roller.readRolls(len(rolls), dice[len(rolls):end])
+		if typed != nil {
+			rolls = append(rolls, typed...)
+			wipeInts(typed)
+		} else if len(rolls) > 0 {
+			wipeInts(rolls[len(rolls)-group:])
+			rolls = rolls[:len(rolls)-group]
+			fmt.Fprintln(diagOut, "The previous group of dice was discarded.")
+		} else {
+			fmt.Fprintln(diagOut, "There is no previous group of dice to undo.")
+		}
+	}
+	system := make([]byte, MIXED_SYSTEM_BYTES)
+	if _, err := io.ReadFull(rand.Reader, system); err != nil {
+		return &SourceError{ERROR_CRNG_TOLD_US_TO_FUCKOFF, fmt.Errorf("cryptographic pseudo random generation failed: %s", err.Error())}
+	}
+	m.dice = dice
+	m.expander = &hashExpander{seed: mixSeed(dice, rolls, system)}
+	wipeInts(rolls)
+	wipeBytes(system)
+	return nil
+}
+
+func (m *MixedImpl) Uniform(n int) (int, error) {
+	// Expander never runs out
+	chRand, _, _ := uniformFromBytes(m.expander, n)
+	return chRand, nil
+}
+
+func (m *MixedImpl) EndSession(p *Passphrase) error {
+	m.roller.finishSession()
+	if m.verbosity > 0 {
+		diceBits := 0.0
+		for _, faces := range m.dice {
+			diceBits = diceBits + math.Log2(float64(faces))
+		}
+		fmt.Fprintf(diagOut, "Dice contributed %.1f bits in %d rolls, system random number generator contributed %d bits.\n", diceBits, len(m.dice), MIXED_SYSTEM_BYTES*8)
+		fmt.Fprintf(diagOut, "Passphrase of %d words needs %.1f bits.\n", len(p.Words), m.bitsNeeded)
+		fmt.Fprintln(diagOut, "Both were hashed together with SHA-512 and words were chosen from SHA-256 expansion of the hash,")
+		fmt.Fprintln(diagOut, "so the passphrase is as strong as estimated if either the dice or the system generator are unpredictable.")
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+)
+
+type diceToRoll_testrecord struct {
+	faces int
+	dice  []int
+	bits  float64
+	count int
+}
+
+func TestMixedDiceToRoll(t *testing.T) {
+	dataset := []diceToRoll_testrecord{
+		diceToRoll_testrecord{faces: 6, bits: 77.5, count: 30},
+		diceToRoll_testrecord{faces: 20, bits: 77.5, count: 18},
+		diceToRoll_testrecord{faces: 6, dice: []int{20, 12, 6, 6}, bits: 12.9, count: 4},
+		diceToRoll_testrecord{faces: 6, dice: []int{20, 12, 6, 6}, bits: 13.1, count: 5},
+	}
+	for num, testrecord := range dataset {
+		m := new(MixedImpl)
+		m.SetDiceFaces(testrecord.faces)
+		m.SetDice(testrecord.dice)
+		count := len(m.diceToRoll(testrecord.bits))
+		if count != testrecord.count {
+			t.Errorf("test number %d failed\n   got: %d\n   expected: %d\n", num+1, count, testrecord.count)
+		}
+	}
+}
+
+func TestMixSeed(t *testing.T) {
+	system := make([]byte, MIXED_SYSTEM_BYTES)
+	seed := mixSeed([]int{6, 6}, []int{1, 2}, system)
+	if !bytes.Equal(seed, mixSeed([]int{6, 6}, []int{1, 2}, system)) {
+		t.Errorf("same input produced different seeds")
+	}
+	if bytes.Equal(seed, mixSeed([]int{6, 6}, []int{2, 1}, system)) {
+		t.Errorf("different rolls produced the same seed")
+	}
+	if bytes.Equal(seed, mixSeed([]int{20, 6}, []int{1, 2}, system)) {
+		t.Errorf("different dice produced the same seed")
+	}
+	system[0] = 1
+	if bytes.Equal(seed, mixSeed([]int{6, 6}, []int{1, 2}, system)) {
+		t.Errorf("different system bytes produced the same seed")
+	}
+}
+
+// Stream must not depend on how it is read
+func TestHashExpander(t *testing.T) {
+	whole := make([]byte, 100)
+	io.ReadFull(&hashExpander{seed: []byte("seed")}, whole)
+	bytewise := make([]byte, 100)
+	ex := &hashExpander{seed: []byte("seed")}
+	for i := range bytewise {
+		io.ReadFull(ex, bytewise[i:i+1])
+	}
+	if !bytes.Equal(whole, bytewise) {
+		t.Errorf("stream differs when read byte by byte")
+	}
+	if bytes.Equal(whole[:32], whole[32:64]) {
+		t.Errorf("blocks repeat")
+	}
+}
+
+// Dice cover random case and characters drawn along with words, not
+// just the words
+func TestMixedDiceForAllBits(t *testing.T) {
+	savedOut := diagOut
+	defer func() { diagOut = savedOut }()
+	diagOut = ioutil.Discard
+	saved := inputReader
+	defer func() { inputReader = saved }()
+	inputReader = newSecretReader(strings.NewReader("1 2 3 4 5\n6\n"))
+
+	words := make([][]byte, 16)
+	for i := range words {
+		words[i] = []byte(fmt.Sprintf("W%d", i))
+	}
+	// 2 words of 4 bits with a bit of random case each, 2 bits of the
+	// delimiter, and the inserted character with its position
+	sampler := &Sampler{Words: words, EntropyPerWord: 5, Case: CaseRandom, LowerWords: lowerForms(words),
+		Delimiters: []rune("0123"), Insert: []rune("!@")}
+	m := new(MixedImpl)
+	m.SetDiceFaces(6)
+	p, err := sampler.Sample(m, 2)
+	if err != nil {
+		t.Fatalf("sampling failed: %s", err.Error())
+	}
+	diceBits := 0.0
+	for _, faces := range m.dice {
+		diceBits = diceBits + math.Log2(float64(faces))
+	}
+	expected := 10 + 2 + 1 + math.Log2(3)
+	if math.Abs(p.Entropy-expected) > 1e-9 || len(m.dice) != 6 || diceBits < p.Entropy {
+		t.Errorf("got: %d dice of %f bits for %f bits\n   expected: 6 dice for %f bits\n", len(m.dice), diceBits, p.Entropy, expected)
+	}
+}
@@ -17,6 +17,7 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"math"
@@ -24,6 +25,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"unicode/utf8"
 )
 
 const VERSION = "0.9b"
@@ -48,6 +50,37 @@ const DICE_NOT_USABLE = 219
 // say why. It doesn't even say if we can retry
 const ERROR_CRNG_TOLD_US_TO_FUCKOFF = 666
 
+// Standard input was closed before user typed everything needed for
+// the passphrase (dice rolls, cards drawn)
+const ERROR_INPUT_ENDED = 218
+
+// Random source file or device ran out of bytes before passphrase was complete
+const ERROR_RANDOM_STREAM_EXHAUSTED = 220
+
+// Dice rolls or bytes from random source failed health tests
+const HEALTH_TEST_FAILED = 221
+
+// Transcript of dice session does not match the passphrase recomputed
+// from its rolls, or its wordlist
+const REPLAY_MISMATCH = 222
+
+// Wordlist has warnings, and --fail-on-warning was given
+const REFUSED_ON_WARNING = 223
+
+// Passphrase could not be written to --output-fd or --output-file
+const ERROR_OUTPUT_FAILED = 224
+
+// Characters of --delimiters or --insert occur in the words, so passphrase
+// can't be split back into them
+const SPECIALS_IN_WORDS = 225
+
+// No passphrase can be built from the wordlist that passes --policy
+const POLICY_UNSATISFIABLE = 226
+
+// Messages about the wordlist and how it is used, prompts and errors.
+// Standard output gets only passphrases, so that it can be piped
+var diagOut io.Writer = os.Stderr
+
 // This shall never happen, but stay vigilant
 const FATAL_NEGATIVE_ENTROPY_ESTIMATE = 333
 
@@ -64,8 +97,8 @@ func GetFileNameFromDictName(dir string, listname string) string {
 		if IsFileExists(fname2) {
 			return fname2
 		}
-		fmt.Printf("There is no such wordlist: \"%s\" installed with the program.\n", listname)
-		fmt.Printf("Use 'offend -l' to enumerate wordlists.\n")
+		fmt.Fprintf(diagOut, "There is no such wordlist: \"%s\" installed with the program.\n", listname)
+		fmt.Fprintf(diagOut, "Use 'offend -l' to enumerate wordlists.\n")
 		os.Exit(1)
 	}
 	return "thiscodeisnotreached"
@@ -81,7 +114,7 @@ func IsFileExists(fname string) bool {
 	} else if os.IsNotExist(err) {
 		return false
 	} else {
-		fmt.Printf("Undefined file state when trying to check for file existence: %s.\n", fname)
+		fmt.Fprintf(diagOut, "Undefined file state when trying to check for file existence: %s.\n", fname)
 		os.Exit(1)
 	}
 	return false // should not be reached
@@ -93,7 +126,7 @@ func GetReaderForFile(fname string) io.Reader {
 	}
 	f, err := os.Open(fname)
 	if err != nil {
-		fmt.Printf("An error has occured while trying to read %s: %s\n", fname, err)
+		fmt.Fprintf(diagOut, "An error has occured while trying to read %s: %s\n", fname, err)
 		os.Exit(1)
 	}
 	return f
@@ -103,12 +136,12 @@ func PrintWordLists() {
 	dir, err1 := os.Open(WORDLIST_DIRECTORY)
 	//ens, err := os.ReadDir(WORDLIST_DIRECTORY) // only since go 1.16
 	if err1 != nil {
-		fmt.Printf("An error has occured while opening directory %s: %s\n", WORDLIST_DIRECTORY, err1)
+		fmt.Fprintf(diagOut, "An error has occured while opening directory %s: %s\n", WORDLIST_DIRECTORY, err1)
 		os.Exit(1)
 	}
 	ens, err2 := dir.Readdir(-1)
 	if err2 != nil {
-		fmt.Printf("An error has occured while trying to list files in directory %s: %s\n", WORDLIST_DIRECTORY, err2)
+		fmt.Fprintf(diagOut, "An error has occured while trying to list files in directory %s: %s\n", WORDLIST_DIRECTORY, err2)
 		os.Exit(1)
 	}
 	wl := make([]string, 0, 0)
@@ -130,33 +163,77 @@ func PrintWordLists() {
 	}
 }
 
-func complainAboutTrimAndExit(totalWords int, usableWords int) {
-	fmt.Printf("The %d is not a power of %d. The floor of %d that is a power of %d is %d.\n", totalWords, sysConfig.DiceFaces, totalWords, sysConfig.DiceFaces, usableWords)
-	fmt.Printf("However, some words are occuring twice or more, thus the selection of %d words out of %d words can't be performed unambiguously.\n", usableWords, totalWords)
+func complainAboutTrimAndExit(totalWords int, usableWords int, dice []int) {
+	if sysConfig.Dice == nil {
+		fmt.Fprintf(diagOut, "The %d is not a power of %d. The floor of %d that is a power of %d is %d.\n", totalWords, dice[0], totalWords, dice[0], usableWords)
+	} else {
+		fmt.Fprintf(diagOut, "The dice set %s has only %d outcomes, fewer than %d words.\n", diceSpecString(dice), usableWords, totalWords)
+	}
+	fmt.Fprintf(diagOut, "However, some words are occuring twice or more, thus the selection of %d words out of %d words can't be performed unambiguously.\n", usableWords, totalWords)
+	fmt.Fprintln(diagOut, "Use --reroll to use the full list.")
 	os.Exit(UNAMBIGUOUS_TRIM)
 }
 
 func main() {
 	configure()
+	if sysConfig.Paranoid {
+		enableParanoid()
+	}
 	if sysConfig.Verbosity > 0 {
-		fmt.Printf("Offend ver %s (c) VigilantDoomer, 2023. All rights reserved.\n", VERSION)
+		fmt.Fprintf(diagOut, "Offend ver %s (c) VigilantDoomer, 2023. All rights reserved.\n", VERSION)
 	}
 	if sysConfig.ListWordLists {
 		PrintWordLists()
 		os.Exit(0)
 	}
+	if sysConfig.Command == CommandDiceStats {
+		PrintDiceStats(sysConfig.CommandArgs)
+		os.Exit(0)
+	}
+	if sysConfig.Command == CommandReplay {
+		ReplayTranscript(sysConfig.CommandArgs[0], sysConfig.DictFileName)
+		os.Exit(0)
+	}
 
 	preamble := false
 
 	// configure user-chosen random passphrase generator with user-chosen delimiter
 	// and number of dice faces (if applicable)
 	currentRnd := NewRndSource(sysConfig.RndSource)
-	currentRnd.SetDelimiter(sysConfig.Delimiter)
+	var dice []int
 	switch c := currentRnd.(type) {
 	case RndSourceWithDice:
 		c.SetDiceFaces(sysConfig.DiceFaces)
+		if sysConfig.Dice != nil {
+			c.SetDice(sysConfig.Dice)
+		}
+		c.SetReroll(sysConfig.Reroll)
+		c.SetDieLabels(sysConfig.DieLabels)
+		preamble = true
+	case *CardsImpl:
+		preamble = true
+	case *ByteStreamImpl:
+		c.Open(sysConfig.RndSourceFile)
+	case *SeededImpl:
+		c.LoadSeed(sysConfig.SeedSpec)
+	case *DerivedImpl:
+		c.SetLabel(sysConfig.CommandArgs[0])
+		c.ReadMaster()
+	case *MixedImpl:
+		c.SetDiceFaces(sysConfig.DiceFaces)
+		if sysConfig.Dice != nil {
+			c.SetDice(sysConfig.Dice)
+		}
+		c.SetDieLabels(sysConfig.DieLabels)
+		c.SetVerbosity(sysConfig.Verbosity)
 		preamble = true
 	}
+	if c, ok := currentRnd.(RndSourceWithHealthTests); ok {
+		c.SetHealthTests(sysConfig.HealthTests)
+	}
+	if sysConfig.DiceInputFile != "" {
+		SetInputFile(sysConfig.DiceInputFile)
+	}
 
 	// dictionary file, depending on the option used, is either identified directly by filename
 	// or is identified by a "dictionary name", which is a name of a file (possibly omitting its extension)
@@ -166,25 +243,124 @@ func main() {
 		fname = GetFileNameFromDictName(WORDLIST_DIRECTORY, sysConfig.WordListName)
 	}
 	rd := GetReaderForFile(fname)
+	var hrd *wordlistHasher
+	if sysConfig.TranscriptFile != "" || sysConfig.Format == FormatJSON {
+		hrd = newWordlistHasher(rd)
+		rd = hrd
+	}
 
 	dupTracker := make(map[string]int)
-	words, gotUpperCaseLettersInSource, wordLenTotal := parseWords(rd, dupTracker)
+	var words [][]byte
+	var codes []DiceCode
+	var gotUpperCaseLettersInSource bool
+	var wordLenTotal int
+	// Words of all slots of a pattern are kept in one list. The same word
+	// may be in several slots, and the checks run on all of them together,
+	// as words of one slot can be prefixes of words of another
+	var slots []wordSlot
+	if sysConfig.Pattern != nil {
+		var err error
+		words, slots, gotUpperCaseLettersInSource, wordLenTotal, err = readPatternWords(sysConfig.Pattern, rd, sysConfig.Case)
+		if err != nil {
+			fmt.Fprintf(diagOut, "Can't read words of the pattern: %s.\n", err.Error())
+			os.Exit(1)
+		}
+		codes = make([]DiceCode, len(words))
+		for _, word := range words {
+			dupTracker[string(word)] = 1
+		}
+	} else {
+		words, codes, gotUpperCaseLettersInSource, wordLenTotal = parseWords(rd, dupTracker, sysConfig.Case)
+	}
+	entropyTarget := sysConfig.Entropy
+	if sysConfig.Choose > 1 {
+		// Extra words make up for the choice
+		entropyTarget = entropyTarget + choiceCost(sysConfig.Choose)
+	}
+	// Passphrases are built to pass the policy: only words that fit it are
+	// kept before any checks, so that checks and entropy are about the words
+	// that can actually be chosen
+	var policyPlanned policyPlan
+	var required [][]rune
+	if pol := sysConfig.Policy; pol != nil {
+		mixed := caseMixesForms(sysConfig.Case)
+		totalWords := len(words)
+		words, codes = keepWords(words, codes, dupTracker, pol.allowedWords(words, mixed))
+		layout := &policyLayout{Delimiter: sysConfig.Delimiter, Delimiters: sysConfig.Delimiters, Insert: sysConfig.Insert}
+		var needSeparators bool
+		var err error
+		layout.Required, needSeparators, err = pol.requiredSets(words, mixed, layout)
+		if err != nil {
+			fmt.Fprintf(diagOut, "Policy can't be passed: %s - exiting.\n", err.Error())
+			os.Exit(POLICY_UNSATISFIABLE)
+		}
+		minWords := int64(1)
+		if needSeparators {
+			minWords = 2
+		}
+		var ok bool
+		policyPlanned, ok = pol.plan(words, sysConfig.Case, layout, currentRnd.Usable, minWords, sysConfig.NumWords, entropyTarget)
+		if !ok {
+			fmt.Fprintln(diagOut, "No passphrase built from this dictionary fits the policy or --max-length - exiting.")
+			os.Exit(POLICY_UNSATISFIABLE)
+		}
+		wordLenTotal = 0
+		for _, word := range words {
+			wordLenTotal = wordLenTotal + utf8.RuneCount(word)
+		}
+		required = layout.Required
+		if sysConfig.Verbosity > 0 {
+			fmt.Fprintf(diagOut, "Policy keeps %d words out of %d.\n", len(words), totalWords)
+			if len(required) > 0 {
+				fmt.Fprintf(diagOut, "Passphrases end with characters of %d classes that the policy requires.\n", len(required))
+			}
+		}
+		if policyPlanned.Share < 0 && (sysConfig.Verbosity > 0 || (preamble && policyPlanned.Share < -1)) {
+			// Dice users should know that they may roll for words that
+			// won't be used
+			fmt.Fprintf(diagOut, "Only 1 in %.1f passphrases of %d words fits the length limits, words of the others are chosen again.\n",
+				math.Exp2(-policyPlanned.Share), policyPlanned.NumWords)
+		}
+	}
 	uniqueWords := len(dupTracker)
 	// How many unique word frequencies are there, and whether any words
 	// are prefixes of any other
 	allCnts, prefixData := getDistinctCountsAndDoPrefixCheck(dupTracker, words)
+	// When words appear in both lower and upper case, prefixes are looked
+	// for among all forms
+	var lower [][]byte
+	if caseMixesForms(sysConfig.Case) {
+		lower = lowerForms(words)
+	}
+	checkedWords, checkedTracker := formsToCheck(words, dupTracker, lower)
+	if slots != nil && lower == nil {
+		checkedWords = sortedWords(dupTracker)
+	}
+	if lower != nil {
+		_, prefixData = getDistinctCountsAndDoPrefixCheck(checkedTracker, checkedWords)
+	}
+
+	// Random separators and inserted characters count toward entropy only
+	// if they can be told apart from the words
+	for _, set := range [][]rune{sysConfig.Delimiters, sysConfig.Insert} {
+		if c, found := specialInWords(set, checkedWords); found {
+			fmt.Fprintf(diagOut, "Character '%c' of --delimiters or --insert occurs in dictionary words.\n", c)
+			fmt.Fprintln(diagOut, "Passphrase could not be split back into words, choose characters that the words don't have - exiting.")
+			os.Exit(SPECIALS_IN_WORDS)
+		}
+	}
 
 	// Abort early if not enough words
 	if len(words) < 2 {
-		fmt.Printf("Discovered only %d words.\n", len(words))
-		fmt.Println("Can't generate random output with less than 2 words - exiting.")
+		fmt.Fprintf(diagOut, "Discovered only %d words.\n", len(words))
+		fmt.Fprintln(diagOut, "Can't generate random output with less than 2 words - exiting.")
 		os.Exit(RANDOMNESS_NEEDS_AT_LEAST_TWO_WORDS)
 	}
 
 	// At least two words need to be distinct
 	if uniqueWords == 1 {
-		fmt.Println("All words are the same word.")
-		fmt.Println("For output to be random, at least 2 words must be distinct - exiting.")
+		fmt.Fprintln(diagOut, "All words are the same word.")
+		fmt.Fprintln(diagOut, "For output to be random, at least 2 words must be distinct - exiting.")
 		os.Exit(RANDOMNESS_NEEDS_DISTINCT_WORDS)
 	}
 
@@ -192,20 +368,73 @@ func main() {
 	var entropyPerWord float64 = 0.0
 	usableWordsNum := currentRnd.Usable(len(words))
 	if usableWordsNum <= 1 {
-		fmt.Println("This number of dice sides can't be used with this dictionary.")
+		fmt.Fprintln(diagOut, "This number of dice sides can't be used with this dictionary.")
 		os.Exit(DICE_NOT_USABLE)
 	}
 
+	// If the dictionary is a printed diceware sheet, words need to be looked up
+	// by the codes printed there, so that the sheet and the program agree
+	sampler := &Sampler{Words: words, Delimiter: sysConfig.Delimiter, Case: sysConfig.Case, LowerWords: lower,
+		Delimiters: sysConfig.Delimiters, Insert: sysConfig.Insert, Required: required, Slots: slots}
+	for _, code := range codes {
+		if code != nil {
+			sampler.Codes = codes
+			break
+		}
+	}
+	switch c := currentRnd.(type) {
+	case RndSourceWithDice:
+		dice = c.Dice(len(words))
+		codeIndex, err := checkDiceCodes(codes, dice)
+		if err != nil {
+			fmt.Fprintf(diagOut, "Dice codes in the dictionary don't match the dice: %s.\n", err.Error())
+			fmt.Fprintln(diagOut, "Words will be chosen by their position in the dictionary instead.")
+			addWarning(WARN_DICE_CODES_MISMATCH, fmt.Sprintf("Dice codes in the dictionary don't match the dice: %s.", err.Error()))
+		} else {
+			sampler.CodeIndex = codeIndex
+		}
+	}
+	info := &GenerationInfo{WordlistFile: fname, RandomSource: sysConfig.RndSourceName}
+	if sysConfig.DictFileName == "" {
+		info.WordlistName = sysConfig.WordListName
+	}
+	if hrd != nil {
+		hash, err := hrd.Hash()
+		if err != nil {
+			fmt.Fprintf(diagOut, "An error has occured while trying to read %s: %s\n", fname, err)
+			os.Exit(1)
+		}
+		info.WordlistSHA256 = hash
+	}
+	if r, ok := currentRnd.(*RealDiceImpl); ok && sysConfig.TranscriptFile != "" {
+		// Transcript is written once all dice are rolled, but whether it
+		// can be is known now, before any rolls are wasted
+		if err := checkNewFile(sysConfig.TranscriptFile); err != nil {
+			fmt.Fprintf(diagOut, "Can't create transcript: %s.\n", err.Error())
+			os.Exit(1)
+		}
+		t := &Transcript{WordlistHash: info.WordlistSHA256, Case: sysConfig.Case}
+		if sysConfig.DictFileName != "" {
+			t.WordlistKind, t.Wordlist = TranscriptDictFile, sysConfig.DictFileName
+		} else {
+			t.WordlistKind, t.Wordlist = TranscriptWordlistName, sysConfig.WordListName
+		}
+		r.SetTranscript(t, sysConfig.TranscriptFile)
+	}
+
 	// TODD refactor / cover entire entropy logic with tests.
 	if len(allCnts) == 1 {
 		if usableWordsNum == len(words) {
 			entropyPerWord = math.Log2(float64(uniqueWords))
 		} else if len(words) != uniqueWords {
-			complainAboutTrimAndExit(len(words), usableWordsNum)
+			complainAboutTrimAndExit(len(words), usableWordsNum, dice)
+		} else {
+			// All words are unique, so the words that are used are unique, too
+			entropyPerWord = math.Log2(float64(usableWordsNum))
 		}
 	} else {
 		if usableWordsNum != len(words) {
-			complainAboutTrimAndExit(len(words), usableWordsNum)
+			complainAboutTrimAndExit(len(words), usableWordsNum, dice)
 		}
 		for i := 0; i < len(allCnts); i++ {
 			thisWordFreq := float64(allCnts[i][0]) / float64(len(words))
@@ -215,12 +444,54 @@ func main() {
 		}
 	}
 
-	entropyTarget := sysConfig.Entropy
+	if sysConfig.Case == CaseRandom {
+		caseEntropy := randomCaseEntropy(words[:usableWordsNum], lower[:usableWordsNum])
+		if sysConfig.Verbosity > 0 {
+			fmt.Fprintf(diagOut, "Random case adds %f bits of entropy per word.\n", caseEntropy)
+		}
+		entropyPerWord = entropyPerWord + caseEntropy
+	}
+
+	if slots != nil {
+		// Every slot adds entropy of its own words
+		patternBits := 0.0
+		for i, slot := range slots {
+			bits, fair := slotEntropy(words, lower, slot)
+			if !fair {
+				fmt.Fprintf(diagOut, "Some words of slot \"%s\" occur more frequently than the others.\n", slot.Name)
+				addWarning(WARN_UNFAIR_DISTRIBUTION, fmt.Sprintf("Some words of slot \"%s\" occur more frequently than the others.", slot.Name))
+			}
+			if sysConfig.Verbosity > 0 {
+				fmt.Fprintf(diagOut, "Word number %d (%s) is one of %d words, %f bits of entropy.\n", i+1, slot.Name, slot.Size, bits)
+			}
+			patternBits = patternBits + bits
+			slotInfo := SlotInfo{Name: slot.Name, Entropy: bits, Offset: slot.Offset,
+				WordlistFile: slot.File, WordlistSHA256: slot.SHA256}
+			if slot.File == "" {
+				// Tags are looked up in the tagged wordlist
+				slotInfo.WordlistName = info.WordlistName
+				slotInfo.WordlistFile = info.WordlistFile
+				slotInfo.WordlistSHA256 = info.WordlistSHA256
+			}
+			info.Slots = append(info.Slots, slotInfo)
+		}
+		entropyPerWord = patternBits / float64(len(slots))
+	}
+
 	numWordsToGenerate := sysConfig.NumWords
+	if slots != nil {
+		numWordsToGenerate = int64(len(slots))
+	}
+	if policyPlanned.NumWords != 0 {
+		numWordsToGenerate = policyPlanned.NumWords
+		// Only passphrases within the length limits are kept, which may
+		// leave fewer of them than the words alone could make
+		entropyPerWord = policyPlanned.WordsEntropy / float64(numWordsToGenerate)
+	}
 	if numWordsToGenerate == 0 {
 		numWordsFraq := entropyTarget / entropyPerWord
 		if entropyPerWord < 0 {
-			fmt.Printf("Fatal error: got negative entropy per word %f\n.", entropyPerWord)
+			fmt.Fprintf(diagOut, "Fatal error: got negative entropy per word %f\n.", entropyPerWord)
 			os.Exit(FATAL_NEGATIVE_ENTROPY_ESTIMATE)
 		}
 
@@ -229,28 +500,57 @@ func main() {
 			// I may be dumb, but I want to be sure
 			numWordsToGenerate++
 		}
+		// Random separators and inserted character make up for some words
+		for numWordsToGenerate > 1 && float64(numWordsToGenerate-1)*entropyPerWord+
+			specialsEntropy(sysConfig.Delimiters, sysConfig.Insert, numWordsToGenerate-1) >= entropyTarget {
+			numWordsToGenerate--
+		}
+	}
+	specialsBits := specialsEntropy(sysConfig.Delimiters, sysConfig.Insert, numWordsToGenerate) + requiredEntropy(required)
+	if slots != nil && float64(numWordsToGenerate)*entropyPerWord+specialsBits < entropyTarget {
+		fmt.Fprintf(diagOut, "Passphrases of this pattern have %.1f bits of entropy, less than %.1f requested.\n", float64(numWordsToGenerate)*entropyPerWord+specialsBits, entropyTarget)
+		fmt.Fprintln(diagOut, "Use a longer pattern, or add --delimiters or --insert.")
+		addWarning(WARN_PATTERN_LIMITS_STRENGTH, fmt.Sprintf("Passphrases of this pattern have %.1f bits of entropy.", float64(numWordsToGenerate)*entropyPerWord+specialsBits))
+	}
+	if sysConfig.Policy != nil && sysConfig.NumWords == 0 &&
+		float64(numWordsToGenerate)*entropyPerWord+specialsBits < entropyTarget {
+		fmt.Fprintf(diagOut, "Passphrases that fit the policy or --max-length have at most %.1f bits of entropy, less than %.1f requested.\n", float64(numWordsToGenerate)*entropyPerWord+specialsBits, entropyTarget)
+		addWarning(WARN_POLICY_LIMITS_STRENGTH, fmt.Sprintf("Passphrases that fit the policy or --max-length have at most %.1f bits of entropy.", float64(numWordsToGenerate)*entropyPerWord+specialsBits))
 	}
 
 	if sysConfig.Verbosity > 0 {
-		fmt.Printf("Read in %d words. Of them %d are unique.\n", len(words), uniqueWords)
+		fmt.Fprintf(diagOut, "Read in %d words. Of them %d are unique.\n", len(words), uniqueWords)
 	}
 
 	if usableWordsNum != len(words) {
-		fmt.Printf("Using only %d words out of %d. This happened because the number of words in the dictionary is not a power of dice sides number (%d).\n", usableWordsNum, len(words), sysConfig.DiceFaces)
+		if sysConfig.Dice == nil {
+			fmt.Fprintf(diagOut, "Using only %d words out of %d. This happened because the number of words in the dictionary is not a power of dice sides number (%d).\n", usableWordsNum, len(words), dice[0])
+		} else {
+			fmt.Fprintf(diagOut, "Using only %d words out of %d. This happened because the dice set %s has fewer outcomes than there are words in the dictionary.\n", usableWordsNum, len(words), diceSpecString(dice))
+		}
+		addWarning(WARN_WORDLIST_TRIMMED, fmt.Sprintf("Using only %d words out of %d.", usableWordsNum, len(words)))
 		if sysConfig.NumWords != 0 {
-			fmt.Println("Given that you specified the number of words to generate directly, you are getting reduced entropy compared to using full list.")
+			fmt.Fprintln(diagOut, "Given that you specified the number of words to generate directly, you are getting reduced entropy compared to using full list.")
+			addWarning(WARN_REDUCED_ENTROPY, "Number of words was specified directly, entropy is reduced compared to using full list.")
 		}
+		fmt.Fprintln(diagOut, "Use --reroll to use the full list.")
 	}
 
+	if len(allCnts) != 1 {
+		addWarning(WARN_UNFAIR_DISTRIBUTION, "Some words occur more frequently than the others.")
+	}
 	if sysConfig.Verbosity > 0 {
 		if len(allCnts) == 1 {
-			fmt.Println("Word distribution is fair (good).")
+			fmt.Fprintln(diagOut, "Word distribution is fair (good).")
 		} else {
-			fmt.Println("Word distribution is NOT fair.")
-			fmt.Println("Some words occur more frequently than the others.")
+			fmt.Fprintln(diagOut, "Word distribution is NOT fair.")
+			fmt.Fprintln(diagOut, "Some words occur more frequently than the others.")
 		}
 		// Valid only if uniquely decodeable
-		fmt.Printf("Entropy per word: %f\n", entropyPerWord)
+		fmt.Fprintf(diagOut, "Entropy per word: %f\n", entropyPerWord)
+		if specialsBits > 0 {
+			fmt.Fprintf(diagOut, "Random separators and added characters add %f bits of entropy.\n", specialsBits)
+		}
 	}
 
 	// Hide average word length and average entropy per character behind
@@ -262,43 +562,186 @@ func main() {
 	if sysConfig.Verbosity >= 2 {
 		avgWordLen := float64(wordLenTotal) / float64(len(words))
 		avgCharEntropy := entropyPerWord / avgWordLen
-		fmt.Printf("Average word length: %f\n", avgWordLen)
-		fmt.Printf("Average entropy per character: %f\n", avgCharEntropy)
+		fmt.Fprintf(diagOut, "Average word length: %f\n", avgWordLen)
+		fmt.Fprintf(diagOut, "Average entropy per character: %f\n", avgCharEntropy)
 	}
 
 	if gotUpperCaseLettersInSource {
-		fmt.Println("Hint: Some dictionary words contain uppercase letters.")
+		fmt.Fprintln(diagOut, "Hint: Some dictionary words contain uppercase letters.")
+		addWarning(WARN_UPPERCASE_WORDS, "Some dictionary words contain uppercase letters.")
 		preamble = true
 	} else {
 		if sysConfig.Verbosity > 0 {
-			fmt.Println("No dictionary words contain uppercase letters (good).")
+			fmt.Fprintln(diagOut, "No dictionary words contain uppercase letters (good).")
 		}
 	}
 
 	if prefixData == nil {
 		if sysConfig.Verbosity > 0 {
-			fmt.Println("No words are prefixes of others (good).")
+			fmt.Fprintln(diagOut, "No words are prefixes of others (good).")
 		}
 	} else {
 		preamble = true
 		// Use SardinasPatterson to check if the dictionary can still generate secure enough passphrases,
 		// if used with caution
-		fmt.Println("The list includes some words that are prefixes of others.")
-		fmt.Printf("Example: word \"%s\" is a prefix of word \"%s\".\n", prefixData[0][0], prefixData[0][1])
-		fmt.Printf("Checking for whether the passphrases are all uniquely decodeable nonetheless... (this might take some time)\n")
-		if SardinasPatterson_IsSafe(words) {
-			fmt.Println("YES, passphrases are all uniquely decodeable. (GOOD)")
-			fmt.Println("Warning: You need to type the generated passphrase verbatim, otherwise unique decodability might CEASE to hold.")
+		fmt.Fprintln(diagOut, "The list includes some words that are prefixes of others.")
+		fmt.Fprintf(diagOut, "Example: word \"%s\" is a prefix of word \"%s\".\n", prefixData[0][0], prefixData[0][1])
+		fmt.Fprintf(diagOut, "Checking for whether the passphrases are all uniquely decodeable nonetheless... (this might take some time)\n")
+		if SardinasPatterson_IsSafe(checkedWords) {
+			fmt.Fprintln(diagOut, "YES, passphrases are all uniquely decodeable. (GOOD)")
+			fmt.Fprintln(diagOut, "Warning: You need to type the generated passphrase verbatim, otherwise unique decodability might CEASE to hold.")
+			addWarning(WARN_PREFIX_WORDS, fmt.Sprintf("Word \"%s\" is a prefix of word \"%s\". Passphrases are uniquely decodable only if typed verbatim.", prefixData[0][0], prefixData[0][1]))
 		} else {
 			// Neither picking a delimiter nor changing words' case guarantees a solution. Delimiter can be present in some words,
 			// words can have different casing that result in new collisions after conversions.
-			fmt.Println("NO, passphrases are not uniquely decodable. (BAD)")
-			fmt.Println("Warning: The enthropy estimate is invalid, the security of your passphrase is LOWER than requested.")
+			fmt.Fprintln(diagOut, "NO, passphrases are not uniquely decodable. (BAD)")
+			fmt.Fprintln(diagOut, "Warning: The enthropy estimate is invalid, the security of your passphrase is LOWER than requested.")
+			addWarning(WARN_NOT_UNIQUELY_DECODABLE, fmt.Sprintf("Word \"%s\" is a prefix of word \"%s\", and passphrases are not uniquely decodable. Entropy estimate is invalid.", prefixData[0][0], prefixData[0][1]))
 		}
 	}
 	preamble = preamble || (sysConfig.Verbosity > 0)
 	if preamble {
-		fmt.Printf("Will generate %d words.\n", numWordsToGenerate)
+		if sysConfig.Count > 1 {
+			fmt.Fprintf(diagOut, "Will generate %d passphrases of %d words.\n", sysConfig.Count, numWordsToGenerate)
+		} else {
+			fmt.Fprintf(diagOut, "Will generate %d words.\n", numWordsToGenerate)
+		}
+	}
+	// Derived passphrases are no stronger than the master passphrase
+	maxEntropy := math.Inf(1)
+	if d, ok := currentRnd.(*DerivedImpl); ok {
+		maxEntropy = d.ReportStrength(float64(numWordsToGenerate)*entropyPerWord+specialsBits, sysConfig.MasterEntropy)
+	}
+	if sysConfig.FailOnWarning && len(reportedWarnings) > 0 {
+		fmt.Fprintln(diagOut, "Refusing to generate a passphrase because of warnings about the wordlist or the random source (--fail-on-warning).")
+		os.Exit(REFUSED_ON_WARNING)
+	}
+	sampler.EntropyPerWord = entropyPerWord
+	sampler.MinWordsLength, sampler.MaxWordsLength = policyPlanned.MinLen, policyPlanned.MaxLen
+	info.EntropyPerWord = entropyPerWord
+	// Output file is checked before dice are rolled, so that rolls are
+	// not wasted if it can't be created. It is created only once the
+	// passphrase is complete: the program may exit before, and an empty
+	// file left behind could be taken for a keyfile
+	var output *os.File
+	var err error
+	if sysConfig.OutputFile != "" {
+		err = checkNewFile(sysConfig.OutputFile)
+	} else {
+		output, err = openOutput(sysConfig.OutputFd, "")
+	}
+	if err != nil {
+		fmt.Fprintf(diagOut, "Can't open output: %s.\n", err.Error())
+		os.Exit(ERROR_OUTPUT_FAILED)
+	}
+	// Passphrases are buffered when there are many of them, except when
+	// the source talks to the user in between
+	out := bufio.NewWriter(os.Stdout)
+	_, interactive := currentRnd.(RndSourceWithSession)
+	for i := int64(0); i < sysConfig.Count; i++ {
+		candidates := make([]*Passphrase, 0, sysConfig.Choose)
+		for len(candidates) < sysConfig.Choose {
+			pass, err := sampler.Sample(currentRnd, numWordsToGenerate)
+			if err != nil {
+				out.Flush()
+				fmt.Fprintf(diagOut, "%s.\n", capitalizeFirst(err.Error()))
+				if serr, ok := err.(*SourceError); ok {
+					os.Exit(serr.ExitCode)
+				}
+				os.Exit(1)
+			}
+			candidates = append(candidates, pass)
+		}
+		pass := candidates[0]
+		if len(candidates) > 1 {
+			pass = chooseCandidate(candidates)
+			for _, c := range candidates {
+				if c != pass {
+					c.Wipe()
+				}
+			}
+		}
+		if sysConfig.FailOnWarning && len(reportedWarnings) > 0 {
+			// Sources find out they look biased only once the passphrase
+			// is generated
+			out.Flush()
+			pass.Wipe()
+			fmt.Fprintln(diagOut, "Refusing to output the passphrase because of warnings about the random source (--fail-on-warning).")
+			os.Exit(REFUSED_ON_WARNING)
+		}
+		if sysConfig.Policy != nil {
+			buf := pass.Bytes()
+			err := sysConfig.Policy.check(buf)
+			releaseSecret(buf)
+			if err != nil {
+				// This shall never happen
+				out.Flush()
+				fmt.Fprintf(diagOut, "Fatal error: %s, though it was built to pass the policy.\n", err.Error())
+				os.Exit(POLICY_UNSATISFIABLE)
+			}
+		}
+		if pass.Entropy > maxEntropy {
+			pass.Entropy = maxEntropy
+		}
+		secret, err := formatPassphrase(sysConfig.Format, pass, info)
+		if err != nil {
+			out.Flush()
+			fmt.Fprintf(diagOut, "Could not format the passphrase: %s.\n", err.Error())
+			os.Exit(1)
+		}
+		if sysConfig.OutputFile != "" {
+			output, err = openOutput(-1, sysConfig.OutputFile)
+			if err != nil {
+				releaseSecret(secret)
+				pass.Wipe()
+				fmt.Fprintf(diagOut, "Can't open output: %s.\n", err.Error())
+				os.Exit(ERROR_OUTPUT_FAILED)
+			}
+		}
+		if output != nil {
+			// Keyfiles and disk encryption take the whole file as the
+			// passphrase, so no newline is added
+			_, err = output.Write(secret)
+			if err == nil {
+				err = output.Close()
+			} else {
+				output.Close()
+			}
+			releaseSecret(secret)
+			pass.Wipe()
+			if err != nil && sysConfig.OutputFile != "" {
+				// Partly written key is worse than none
+				os.Remove(sysConfig.OutputFile)
+			}
+			if err != nil {
+				fmt.Fprintf(diagOut, "Could not write the passphrase: %s.\n", err.Error())
+				os.Exit(ERROR_OUTPUT_FAILED)
+			}
+			continue
+		}
+		if paranoid {
+			// Buffered writer would keep a copy
+			out.Flush()
+			os.Stdout.Write(secret)
+			os.Stdout.Write([]byte{'\n'})
+		} else {
+			out.Write(secret)
+			out.WriteByte('\n')
+		}
+		releaseSecret(secret)
+		pass.Wipe()
+		if interactive {
+			out.Flush()
+		}
+	}
+	out.Flush()
+}
+
+// Error messages start with lowercase letter, as is usual in Go, but are
+// printed as sentences
+func capitalizeFirst(s string) string {
+	if s == "" {
+		return s
 	}
-	fmt.Println(currentRnd.Generate(words, numWordsToGenerate))
+	return strings.ToUpper(s[:1]) + s[1:]
 }
@@ -0,0 +1,207 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains output formats of generated passphrases, and warnings about
+// the wordlist and how it is used, which scripts can tell apart by code
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Codes of warnings. They are part of JSON output, so they never change
+const (
+	// Dice codes printed in the wordlist don't match dice that are rolled
+	WARN_DICE_CODES_MISMATCH = "dice-codes-mismatch"
+	// Only some of the words can be chosen with the dice
+	WARN_WORDLIST_TRIMMED = "wordlist-trimmed"
+	// Number of words was given directly, and fewer words can be chosen
+	// than there are in the wordlist
+	WARN_REDUCED_ENTROPY = "reduced-entropy"
+	// Some words occur more often than others
+	WARN_UNFAIR_DISTRIBUTION = "unfair-distribution"
+	WARN_UPPERCASE_WORDS     = "uppercase-words"
+	// Some words are prefixes of others, but passphrases are still
+	// uniquely decodable if typed verbatim
+	WARN_PREFIX_WORDS = "prefix-words"
+	// Different choices of words can give the same passphrase, so entropy
+	// estimate is too high
+	WARN_NOT_UNIQUELY_DECODABLE = "not-uniquely-decodable"
+	// Derived passphrase is limited by strength of the master passphrase
+	WARN_MASTER_LIMITS_STRENGTH = "master-limits-strength"
+	// Password policy or length limit leaves too few passphrases to reach
+	// the requested entropy
+	WARN_POLICY_LIMITS_STRENGTH = "policy-limits-strength"
+	// Words of the phrase pattern don't reach the requested entropy
+	WARN_PATTERN_LIMITS_STRENGTH = "pattern-limits-strength"
+	// Passphrase comes from a seed given to "seeded:" source
+	WARN_SEEDED_NOT_RANDOM = "seeded-not-random"
+	// Values of dice, coins or a random stream failed the goodness of fit
+	// test once the passphrase was generated
+	WARN_SOURCE_BIASED = "source-biased"
+)
+
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Warnings found while checking the wordlist and settings, printed with
+// every passphrase in JSON output
+var reportedWarnings = make([]Warning, 0)
+
+// Warnings of sources may come with every passphrase, each is kept once
+func addWarning(code string, message string) {
+	for _, w := range reportedWarnings {
+		if w.Code == code && w.Message == message {
+			return
+		}
+	}
+	reportedWarnings = append(reportedWarnings, Warning{Code: code, Message: message})
+}
+
+// What passphrases were generated from, the same for all of them
+type GenerationInfo struct {
+	WordlistName   string
+	WordlistFile   string
+	WordlistSHA256 string
+	RandomSource   string
+	EntropyPerWord float64
+	// Slots of the phrase pattern every word is drawn from in turn, nil if
+	// there is no pattern
+	Slots []SlotInfo
+}
+
+// Slot of a phrase pattern, the wordlist it has its words from, and
+// entropy of the word drawn from it
+type SlotInfo struct {
+	Name           string
+	Entropy        float64
+	WordlistName   string
+	WordlistFile   string
+	WordlistSHA256 string
+	// Index of the first word of the slot among words of all slots
+	Offset int
+}
+
+type wordlistJSON struct {
+	Name   string `json:"name,omitempty"`
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+}
+
+type wordJSON struct {
+	Word  string `json:"word"`
+	Index int    `json:"index"`
+	Code  string `json:"code,omitempty"`
+	// Only with a phrase pattern, words of slots differ in entropy and
+	// wordlist, and index is within the wordlist of the slot
+	Slot     string        `json:"slot,omitempty"`
+	Entropy  *float64      `json:"entropy,omitempty"`
+	Wordlist *wordlistJSON `json:"wordlist,omitempty"`
+}
+
+type passphraseJSON struct {
+	Passphrase     string        `json:"passphrase"`
+	Words          []wordJSON    `json:"words"`
+	EntropyPerWord *float64      `json:"entropy_per_word,omitempty"`
+	Entropy        float64       `json:"entropy"`
+	Wordlist       *wordlistJSON `json:"wordlist,omitempty"`
+	RandomSource   string        `json:"random_source"`
+	Warnings       []Warning     `json:"warnings"`
+}
+
+// Formats passphrase as one JSON object on a single line
+func formatPassphraseJSON(p *Passphrase, info *GenerationInfo, warnings []Warning) ([]byte, error) {
+	out := passphraseJSON{
+		Passphrase:   p.String(),
+		Words:        make([]wordJSON, len(p.Words)),
+		Entropy:      p.Entropy,
+		RandomSource: info.RandomSource,
+		Warnings:     warnings,
+	}
+	for i, word := range p.Words {
+		out.Words[i] = wordJSON{Word: string(word), Index: p.Indices[i]}
+		if p.Codes != nil && p.Codes[i] != nil {
+			out.Words[i].Code = p.Codes[i].String()
+		}
+		if info.Slots != nil {
+			slot := &info.Slots[i]
+			out.Words[i].Index = p.Indices[i] - slot.Offset
+			out.Words[i].Slot = slot.Name
+			out.Words[i].Entropy = &slot.Entropy
+			out.Words[i].Wordlist = &wordlistJSON{
+				Name:   slot.WordlistName,
+				File:   slot.WordlistFile,
+				SHA256: slot.WordlistSHA256,
+			}
+		}
+	}
+	if info.Slots == nil {
+		// Average over slots would match none of them, and every slot
+		// names its own wordlist
+		out.EntropyPerWord = &info.EntropyPerWord
+		out.Wordlist = &wordlistJSON{
+			Name:   info.WordlistName,
+			File:   info.WordlistFile,
+			SHA256: info.WordlistSHA256,
+		}
+	}
+	return json.Marshal(out)
+}
+
+// Passphrase as it is written out, in a buffer the caller wipes afterwards
+func formatPassphrase(format string, p *Passphrase, info *GenerationInfo) ([]byte, error) {
+	if format == FormatJSON {
+		return formatPassphraseJSON(p, info, reportedWarnings)
+	}
+	return p.Bytes(), nil
+}
+
+// Checks that a file which must not exist yet can be created, without
+// leaving it behind, for files written only once the passphrase is complete
+func checkNewFile(fname string) error {
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(fname)
+}
+
+// Opens where the passphrase is written instead of standard output: file
+// that must not exist yet, or file descriptor inherited from the parent
+// process. Returns nil if neither is given
+func openOutput(fd int, fname string) (*os.File, error) {
+	if fname != "" {
+		return os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	}
+	if fd >= 0 {
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("file descriptor %d", fd))
+		if f == nil {
+			return nil, fmt.Errorf("file descriptor %d is not valid", fd)
+		}
+		return f, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,147 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type formatPassphraseJSON_testrecord struct {
+	p        *Passphrase
+	warnings []Warning
+	// Slots of the phrase pattern, if any
+	slots []SlotInfo
+	json  string
+}
+
+func TestFormatPassphraseJSON(t *testing.T) {
+	info := &GenerationInfo{
+		WordlistName:   "offend_fast",
+		WordlistFile:   "wordlists/offend_fast.txt",
+		WordlistSHA256: "ab12",
+		RandomSource:   "system",
+		EntropyPerWord: 12.5,
+	}
+	dataset := []formatPassphraseJSON_testrecord{
+		formatPassphraseJSON_testrecord{
+			p: &Passphrase{
+				Indices:   []int{3, 0},
+				Words:     [][]byte{[]byte("Dog"), []byte("Cat")},
+				Delimiter: "-",
+				Entropy:   25,
+			},
+			warnings: []Warning{},
+			json:     `{"passphrase":"Dog-Cat","words":[{"word":"Dog","index":3},{"word":"Cat","index":0}],"entropy_per_word":12.5,"entropy":25,"wordlist":{"name":"offend_fast","file":"wordlists/offend_fast.txt","sha256":"ab12"},"random_source":"system","warnings":[]}`,
+		},
+		formatPassphraseJSON_testrecord{
+			p: &Passphrase{
+				Indices: []int{5},
+				Words:   [][]byte{[]byte("Owl")},
+				Codes:   []DiceCode{DiceCode{1, 2}},
+				Entropy: 12.5,
+			},
+			warnings: []Warning{Warning{Code: WARN_UPPERCASE_WORDS, Message: "Some dictionary words contain uppercase letters."}},
+			json:     `{"passphrase":"Owl","words":[{"word":"Owl","index":5,"code":"12"}],"entropy_per_word":12.5,"entropy":12.5,"wordlist":{"name":"offend_fast","file":"wordlists/offend_fast.txt","sha256":"ab12"},"random_source":"system","warnings":[{"code":"uppercase-words","message":"Some dictionary words contain uppercase letters."}]}`,
+		},
+		// Words of a pattern have entropy and wordlist of their slots
+		// instead of the entropy per word and the wordlist, and index
+		// within the wordlist of the slot
+		formatPassphraseJSON_testrecord{
+			p: &Passphrase{
+				Indices: []int{1, 4},
+				Words:   [][]byte{[]byte("Angry"), []byte("Badger")},
+				Entropy: 11,
+			},
+			warnings: []Warning{},
+			slots: []SlotInfo{
+				SlotInfo{Name: "adj", Entropy: 3, WordlistName: "tagged", WordlistFile: "wordlists/tagged.txt", WordlistSHA256: "cd34"},
+				SlotInfo{Name: "file:nouns.txt", Entropy: 8, WordlistFile: "nouns.txt", WordlistSHA256: "ef56", Offset: 2},
+			},
+			json: `{"passphrase":"AngryBadger","words":[{"word":"Angry","index":1,"slot":"adj","entropy":3,"wordlist":{"name":"tagged","file":"wordlists/tagged.txt","sha256":"cd34"}},{"word":"Badger","index":2,"slot":"file:nouns.txt","entropy":8,"wordlist":{"file":"nouns.txt","sha256":"ef56"}}],"entropy":11,"random_source":"system","warnings":[]}`,
+		},
+	}
+	for num, testrecord := range dataset {
+		info.Slots = testrecord.slots
+		got, err := formatPassphraseJSON(testrecord.p, info, testrecord.warnings)
+		if err != nil || string(got) != testrecord.json {
+			t.Errorf("test number %d failed\n   got: %s (error %v)\n   expected: %s\n", num+1, got, err, testrecord.json)
+		}
+	}
+}
+
+type openOutput_testrecord struct {
+	passphrase *Passphrase
+	content    string
+}
+
+// Files get exactly the passphrase and are readable only by the owner
+func TestOpenOutputFile(t *testing.T) {
+	dataset := []openOutput_testrecord{
+		openOutput_testrecord{passphrase: &Passphrase{Words: [][]byte{[]byte("Dog"), []byte("Cat")}, Delimiter: " "}, content: "Dog Cat"},
+		openOutput_testrecord{passphrase: &Passphrase{Words: [][]byte{[]byte("Owl")}, Delimiter: "-"}, content: "Owl"},
+	}
+	for num, testrecord := range dataset {
+		fname := filepath.Join(t.TempDir(), "key")
+		f, err := openOutput(-1, fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secret := testrecord.passphrase.Bytes()
+		f.Write(secret)
+		f.Close()
+		wipeBytes(secret)
+		content, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stat, err := os.Stat(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != testrecord.content || stat.Mode().Perm()&0077 != 0 || !bytes.Equal(secret, make([]byte, len(secret))) {
+			t.Errorf("test number %d failed\n   got: %q with mode %v\n   expected: %q readable only by owner\n", num+1, content, stat.Mode(), testrecord.content)
+		}
+		// Existing file is never overwritten
+		if _, err := openOutput(-1, fname); err == nil {
+			t.Errorf("test number %d failed: existing file was opened again\n", num+1)
+		}
+	}
+}
+
+// Check leaves nothing behind, and fails for a file that exists
+func TestCheckNewFile(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "transcript")
+	if err := checkNewFile(fname); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fname); !os.IsNotExist(err) {
+		t.Errorf("file was left behind by the check\n")
+	}
+	if err := ioutil.WriteFile(fname, []byte("keep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkNewFile(fname); err == nil {
+		t.Errorf("check passed for a file that exists\n")
+	}
+	if content, _ := ioutil.ReadFile(fname); string(content) != "keep" {
+		t.Errorf("existing file was changed to %q\n", content)
+	}
+}
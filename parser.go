@@ -22,21 +22,68 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 
 	"golang.org/x/text/unicode/norm"
 )
 
-// A regular expression with one capturing subgroup that should match a word in either
-// a numbered dictionary entry or an unnumbered one.
-var FIND_WORD_REGEX *regexp.Regexp = regexp.MustCompile(`^[0-9]+(?:-[0-9]+)*\s+([^\s]+)$`)
+// A regular expression with two capturing subgroups that should match a dice code
+// and a word in a numbered dictionary entry.
+var FIND_WORD_REGEX *regexp.Regexp = regexp.MustCompile(`^([0-9]+(?:-[0-9]+)*)\s+([^\s]+)$`)
+
+// The numbers that must show on dice, in order, for a dictionary entry to be
+// selected. Both "11111" (one digit per die) and "1-1-10" (dash-separated)
+// notations are parsed into the same representation
+type DiceCode []int
+
+// Parses dice code as printed in the dictionary. Returns nil if one of the
+// numbers is not valid
+func parseDiceCode(code []byte) DiceCode {
+	var parts []string
+	if bytes.IndexByte(code, '-') >= 0 {
+		parts = strings.Split(string(code), "-")
+	} else {
+		parts = strings.Split(string(code), "")
+	}
+	ret := make(DiceCode, 0, len(parts))
+	for _, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return nil
+		}
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+// Dice code in the notation it would be printed in the dictionary
+func (c DiceCode) String() string {
+	dashed := false
+	for _, v := range c {
+		if v > 9 {
+			dashed = true
+		}
+	}
+	strs := make([]string, 0, len(c))
+	for _, v := range c {
+		strs = append(strs, strconv.Itoa(v))
+	}
+	if dashed {
+		return strings.Join(strs, "-")
+	}
+	return strings.Join(strs, "")
+}
 
 // Parses input dictionary, stores and indexes all words into
-// a slice for fast lookup
-func parseWords(rd io.Reader, dupTracker map[string]int) ([][]byte, bool, int) {
+// a slice for fast lookup. Dice codes are returned in a parallel slice,
+// with nil for every word that didn't have one
+func parseWords(rd io.Reader, dupTracker map[string]int, caseMode string) ([][]byte, []DiceCode, bool, int) {
 	// Arbitrary slice initial size - fix later
 	ret := make([][]byte, 0, 7770)
+	codes := make([]DiceCode, 0, 7770)
 	sc := bufio.NewScanner(rd)
 	firstLineChecked := false
 	signed := false
@@ -51,8 +98,8 @@ func parseWords(rd io.Reader, dupTracker map[string]int) ([][]byte, bool, int) {
 			// TODO refer to input by name, possibly on a separate line so as not
 			// to obscure line number and error message. Somewhere between "input line"
 			// and "scan aborted" message
-			fmt.Printf("Scan: input line %d: encountered an error: %s.\n", lineNum, err)
-			fmt.Println("Dictionary scan aborted, discarding remaining words.")
+			fmt.Fprintf(diagOut, "Scan: input line %d: encountered an error: %s.\n", lineNum, err)
+			fmt.Fprintln(diagOut, "Dictionary scan aborted, discarding remaining words.")
 			break
 		}
 
@@ -84,7 +131,7 @@ func parseWords(rd io.Reader, dupTracker map[string]int) ([][]byte, bool, int) {
 		}
 
 		// parseOneWord allocates new memory for result
-		wrd := parseOneWord(line, signed)
+		wrd, code := parseOneWord(line, signed)
 		if wrd != nil {
 			// For PGP signed dictionary, we stop processing upon encountering
 			// PGP signature
@@ -97,11 +144,10 @@ func parseWords(rd io.Reader, dupTracker map[string]int) ([][]byte, bool, int) {
 			// contains both words that begin with a capital letter and those that don't,
 			// capitalization may introduce DUPLICATES and PREFIX PROBLEM where there
 			// were NONE.
-			if sysConfig.Capitalize {
-				patchFirstLetterToUpperCase_InPlace(wrd)
-			}
+			wrd = applyCase(wrd, caseMode)
 			// Add this word to result list
 			ret = append(ret, wrd)
+			codes = append(codes, code)
 			// Increment the number this word has been seen, if any
 			tmpShit := string(wrd)
 			wordLenTotal = wordLenTotal + utf8.RuneCountInString(tmpShit)
@@ -110,7 +156,7 @@ func parseWords(rd io.Reader, dupTracker map[string]int) ([][]byte, bool, int) {
 		}
 		lineNum = lineNum + 1
 	}
-	return ret, gotUpperCaseLettersInSource, wordLenTotal
+	return ret, codes, gotUpperCaseLettersInSource, wordLenTotal
 }
 
 // Returns true if two byte slices reference same place in memory
@@ -121,12 +167,13 @@ func sameRef_NEBS(nonEmptyByteSlice1, nonEmptyByteSlice2 []byte) bool {
 
 // Finds a word within a line of dictionary
 // If a line does not contain a word, returns nil
-// Otherwise returns the found word
+// Otherwise returns the found word, and its dice code if there
+// was one (nil otherwise)
 // MUST allocate new bytes for non-nil result,
 // because wrd slice refers to memory inside a Scanner's buffer
-func parseOneWord(wrd []byte, signed bool) []byte {
+func parseOneWord(wrd []byte, signed bool) ([]byte, DiceCode) {
 	if wrd == nil {
-		return nil
+		return nil, nil
 	}
 	if signed && bytes.HasPrefix(wrd, []byte("- ")) {
 		wrd = wrd[2:]
@@ -134,18 +181,20 @@ func parseOneWord(wrd []byte, signed bool) []byte {
 	// Remove whitespace left and right
 	wrd = bytes.TrimSpace(wrd)
 	if wrd == nil || len(wrd) == 0 {
-		return nil
+		return nil, nil
 	}
 	smatch := FIND_WORD_REGEX.FindSubmatch(wrd)
 	// It's called volatile, because it refers
 	// to the current token in Scanner's buffer
 	var volatile_data []byte
+	var code DiceCode
 	if smatch == nil {
 		// Couldn't parse out a word, will assume
 		// the whole line is one dictionary "word"
 		volatile_data = wrd
 	} else {
-		volatile_data = smatch[1]
+		code = parseDiceCode(smatch[1])
+		volatile_data = smatch[2]
 	}
 
 	// Perform normalization under NFC - affects
@@ -171,21 +220,5 @@ func parseOneWord(wrd []byte, signed bool) []byte {
 		// normalized data, they are safe to return
 		ret = normalizedData
 	}
-	return ret
-}
-
-// Overwrites the first letter of the byte slice so it is uppercase
-// Doesn't return anything
-// Auxilary memory allocation may actually happen, but the
-// original slice points to the same memory address, while
-// the contents are altered
-// ? avoid memory allocation maybe
-func patchFirstLetterToUpperCase_InPlace(word []byte) {
-	r, firstRuneSize := utf8.DecodeRune(word)
-	if r != utf8.RuneError {
-		sl2 := bytes.ToUpper(word[0:firstRuneSize])
-		if !sameRef_NEBS(sl2, word) {
-			copy(word[0:firstRuneSize], sl2[0:firstRuneSize])
-		}
-	}
+	return ret, code
 }
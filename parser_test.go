@@ -26,27 +26,30 @@ type parseOneWord_testrecord struct {
 	wrd    string
 	signed bool
 	result string
+	code   string
 }
 
 type parseWords_testrecord struct {
-	input            []string
-	configCapitalize bool
-	words            []string
-	hasCaps          bool
+	input    []string
+	caseMode string
+	words    []string
+	hasCaps  bool
 }
 
 func TestParseOneWord(t *testing.T) {
 	dataset := []parseOneWord_testrecord{
-		parseOneWord_testrecord{wrd: "111 vigilant", signed: false, result: "vigilant"},
-		parseOneWord_testrecord{wrd: "solstice", signed: false, result: "solstice"},
-		parseOneWord_testrecord{wrd: "- mortem", signed: true, result: "mortem"},
-		parseOneWord_testrecord{wrd: "- 111 jupiter", signed: true, result: "jupiter"},
-		parseOneWord_testrecord{wrd: "111", signed: false, result: "111"},
+		parseOneWord_testrecord{wrd: "111 vigilant", signed: false, result: "vigilant", code: "111"},
+		parseOneWord_testrecord{wrd: "solstice", signed: false, result: "solstice", code: ""},
+		parseOneWord_testrecord{wrd: "- mortem", signed: true, result: "mortem", code: ""},
+		parseOneWord_testrecord{wrd: "- 111 jupiter", signed: true, result: "jupiter", code: "111"},
+		parseOneWord_testrecord{wrd: "111", signed: false, result: "111", code: ""},
+		parseOneWord_testrecord{wrd: "1-12-20\tzweig", signed: false, result: "zweig", code: "1-12-20"},
+		parseOneWord_testrecord{wrd: "1-1-1\taback", signed: false, result: "aback", code: "111"},
 	}
 	for _, testrecord := range dataset {
-		res := parseOneWord([]byte(testrecord.wrd), testrecord.signed)
-		if string(res) != testrecord.result {
-			t.Errorf("parsed record: \n   line: %s\n   signed: %t\n   got: %s\n   expected: %s\n", testrecord.wrd, testrecord.signed, res, testrecord.result)
+		res, code := parseOneWord([]byte(testrecord.wrd), testrecord.signed)
+		if string(res) != testrecord.result || code.String() != testrecord.code {
+			t.Errorf("parsed record: \n   line: %s\n   signed: %t\n   got: %s (code %s)\n   expected: %s (code %s)\n", testrecord.wrd, testrecord.signed, res, code, testrecord.result, testrecord.code)
 		}
 	}
 }
@@ -87,7 +90,7 @@ func TestParseWords(t *testing.T) {
 		Verbosity:     0,
 		Entropy:       0,
 		Delimiter:     "",
-		Capitalize:    false,
+		Case:          CaseNone,
 		WordListName:  "",
 		ListWordLists: false,
 		DictFileName:  "",
@@ -97,21 +100,29 @@ func TestParseWords(t *testing.T) {
 	sysConfig = defConfig
 	dataset := []parseWords_testrecord{
 		parseWords_testrecord{input: []string{"111 vigilant", "112 solstice", "113 mortem", "114 jupiter"},
-			configCapitalize: true,
-			words:            []string{"Vigilant", "Solstice", "Mortem", "Jupiter"},
-			hasCaps:          false},
+			caseMode: CaseFirst,
+			words:    []string{"Vigilant", "Solstice", "Mortem", "Jupiter"},
+			hasCaps:  false},
 		parseWords_testrecord{input: []string{"-----BEGIN PGP SIGNED MESSAGE-----",
 			"Hash: oops (not inventing for the test)", "", "111 vigilant", "112 solstice", "113 mortem", "114 jupiter", "115 ashore", "-----BEGIN PGP SIGNATURE-----",
 			"", "Lol! just kidding. No sig here", "-----END PGP SIGNATURE-----"},
-			configCapitalize: false,
-			words:            []string{"vigilant", "solstice", "mortem", "jupiter", "ashore"},
-			hasCaps:          false},
+			caseMode: CaseNone,
+			words:    []string{"vigilant", "solstice", "mortem", "jupiter", "ashore"},
+			hasCaps:  false},
+		parseWords_testrecord{input: []string{"vigilant", "Solstice", "ärger"},
+			caseMode: CaseAll,
+			words:    []string{"VIGILANT", "SOLSTICE", "ÄRGER"},
+			hasCaps:  true},
+		// Modes that mix forms keep the upper case one
+		parseWords_testrecord{input: []string{"vigilant", "Solstice", "ärger", "42"},
+			caseMode: CaseRandom,
+			words:    []string{"Vigilant", "Solstice", "Ärger", "42"},
+			hasCaps:  true},
 	}
 	for num, testrecord := range dataset {
-		sysConfig.Capitalize = testrecord.configCapitalize
 		dupTracker := make(map[string]int)
 		inputText := stringArrayToTextIo(testrecord.input)
-		words, hasCaps, _ := parseWords(inputText, dupTracker)
+		words, _, hasCaps, _ := parseWords(inputText, dupTracker, testrecord.caseMode)
 		if !cmpParseWordsResult(testrecord, words, hasCaps) {
 			// Lazy, but then again, these are supposed to be whole texts
 			// Oh yeah, and human numbers start from 1, unlike machine numbers
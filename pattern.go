@@ -0,0 +1,156 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains phrase patterns, where every word of the passphrase is
+// drawn from a wordlist of its own, such as adjectives or nouns
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Slot of a pattern given as this prefix and a path reads its words from
+// that file, any other slot is a tag of the tagged wordlist
+const PATTERN_FILE_PREFIX = "file:"
+
+// Words one word of the passphrase is drawn from, a part of the list that
+// holds words of all slots
+type wordSlot struct {
+	// As given in the pattern
+	Name   string
+	Offset int
+	Size   int
+	// Wordlist file of a file: slot and its SHA-256, empty for tags
+	File   string
+	SHA256 string
+}
+
+// Parses pattern such as "adj,noun,verb,noun" into its slots
+func parsePattern(spec string) ([]string, error) {
+	slots := strings.Split(spec, ",")
+	for i, slot := range slots {
+		slots[i] = strings.TrimSpace(slot)
+		if slots[i] == "" || slots[i] == PATTERN_FILE_PREFIX {
+			return nil, fmt.Errorf("slot number %d is empty", i+1)
+		}
+	}
+	return slots, nil
+}
+
+// Reads tagged wordlist, where every line is a word followed by its tag,
+// such as "badger noun". Returns words by their tag, as they are written
+func parseTaggedWords(rd io.Reader) (map[string][][]byte, error) {
+	// Lines are read as words to get the same handling of signed wordlists
+	// and normalization, and split afterwards
+	lines, _, _, _ := parseWords(rd, make(map[string]int), CaseNone)
+	ret := make(map[string][][]byte)
+	for _, line := range lines {
+		fields := bytes.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line \"%s\" is not a word followed by its tag", line)
+		}
+		tag := string(fields[1])
+		ret[tag] = append(ret[tag], fields[0])
+	}
+	return ret, nil
+}
+
+// Reads words of all slots into one list. Tags are looked up in the tagged
+// wordlist read from tagged, which is not read if no slot needs it.
+// Slots with the same name share their words. Also returns whether any
+// of the words have upper case letters, and their total length, as
+// parseWords does
+func readPatternWords(slots []string, tagged io.Reader, caseMode string) ([][]byte, []wordSlot, bool, int, error) {
+	words := make([][]byte, 0)
+	ret := make([]wordSlot, len(slots))
+	gotUpperCase := false
+	wordLenTotal := 0
+	var tags map[string][][]byte
+	seen := make(map[string]wordSlot)
+	for i, name := range slots {
+		if slot, ok := seen[name]; ok {
+			ret[i] = slot
+			continue
+		}
+		var slotWords [][]byte
+		var fname, hash string
+		if strings.HasPrefix(name, PATTERN_FILE_PREFIX) {
+			fname = name[len(PATTERN_FILE_PREFIX):]
+			f, err := os.Open(fname)
+			if err != nil {
+				return nil, nil, false, 0, err
+			}
+			hrd := newWordlistHasher(f)
+			var upper bool
+			var length int
+			slotWords, _, upper, length = parseWords(hrd, make(map[string]int), caseMode)
+			hash, err = hrd.Hash()
+			f.Close()
+			if err != nil {
+				return nil, nil, false, 0, err
+			}
+			gotUpperCase = gotUpperCase || upper
+			wordLenTotal = wordLenTotal + length
+		} else {
+			if tags == nil {
+				var err error
+				tags, err = parseTaggedWords(tagged)
+				if err != nil {
+					return nil, nil, false, 0, err
+				}
+			}
+			for _, word := range tags[name] {
+				gotUpperCase = gotUpperCase || hasUpperCaseChars(word)
+				wordLenTotal = wordLenTotal + utf8.RuneCount(word)
+				slotWords = append(slotWords, applyCase(word, caseMode))
+			}
+		}
+		if len(slotWords) < 2 {
+			return nil, nil, false, 0, fmt.Errorf("slot \"%s\" has fewer than 2 words", name)
+		}
+		ret[i] = wordSlot{Name: name, Offset: len(words), Size: len(slotWords), File: fname, SHA256: hash}
+		seen[name] = ret[i]
+		words = append(words, slotWords...)
+	}
+	return words, ret, gotUpperCase, wordLenTotal, nil
+}
+
+// Entropy of a word drawn from the slot, and whether all of its words
+// occur equally often. Lower case forms are given if case is random
+func slotEntropy(words [][]byte, lower [][]byte, slot wordSlot) (float64, bool) {
+	slotWords := words[slot.Offset : slot.Offset+slot.Size]
+	counts := make(map[string]int)
+	for _, word := range slotWords {
+		counts[string(word)]++
+	}
+	bits := 0.0
+	fair := true
+	for _, cnt := range counts {
+		freq := float64(cnt) / float64(slot.Size)
+		bits = bits - freq*math.Log2(freq)
+		fair = fair && cnt == counts[string(slotWords[0])]
+	}
+	if lower != nil {
+		bits = bits + randomCaseEntropy(slotWords, lower[slot.Offset:slot.Offset+slot.Size])
+	}
+	return bits, fair
+}
@@ -0,0 +1,162 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type parsePattern_testrecord struct {
+	spec   string
+	slots  []string
+	hasErr bool
+}
+
+func TestParsePattern(t *testing.T) {
+	dataset := []parsePattern_testrecord{
+		parsePattern_testrecord{spec: "adj,noun,verb,noun", slots: []string{"adj", "noun", "verb", "noun"}},
+		parsePattern_testrecord{spec: "adj, file:adverbs.txt", slots: []string{"adj", "file:adverbs.txt"}},
+		parsePattern_testrecord{spec: "adj,,noun", hasErr: true},
+		parsePattern_testrecord{spec: "adj,file:", hasErr: true},
+	}
+	for num, testrecord := range dataset {
+		slots, err := parsePattern(testrecord.spec)
+		if (err != nil) != testrecord.hasErr || !reflect.DeepEqual(slots, testrecord.slots) {
+			t.Errorf("test number %d failed\n   got: %q (error %v)\n   expected: %q\n", num+1, slots, err, testrecord.slots)
+		}
+	}
+}
+
+const testTaggedWordlist = `angry adj
+sleepy adj
+badger noun
+turnip noun
+otter noun
+eats verb
+`
+
+type readPatternWords_testrecord struct {
+	tagged string
+	slots  []string
+	words  string
+	// Offset and size of every slot
+	layout []int
+	hasErr bool
+}
+
+func TestReadPatternWords(t *testing.T) {
+	dataset := []readPatternWords_testrecord{
+		// Slots with the same tag share their words
+		readPatternWords_testrecord{tagged: testTaggedWordlist, slots: []string{"adj", "noun", "adj"},
+			words: "Angry Sleepy Badger Turnip Otter", layout: []int{0, 2, 2, 3, 0, 2}},
+		readPatternWords_testrecord{tagged: testTaggedWordlist, slots: []string{"noun", "verb"}, hasErr: true},
+		readPatternWords_testrecord{tagged: testTaggedWordlist, slots: []string{"noun", "adverb"}, hasErr: true},
+		readPatternWords_testrecord{tagged: "angry adj\nbadger\n", slots: []string{"adj"}, hasErr: true},
+	}
+	for num, testrecord := range dataset {
+		words, slots, _, _, err := readPatternWords(testrecord.slots, strings.NewReader(testrecord.tagged), CaseFirst)
+		layout := make([]int, 0, 2*len(slots))
+		for _, slot := range slots {
+			layout = append(layout, slot.Offset, slot.Size)
+		}
+		if testrecord.hasErr {
+			if err == nil {
+				t.Errorf("test number %d failed\n   got: %q\n   expected an error\n", num+1, words)
+			}
+			continue
+		}
+		if err != nil || string(bytes.Join(words, []byte(" "))) != testrecord.words ||
+			!reflect.DeepEqual(layout, testrecord.layout) {
+			t.Errorf("test number %d failed\n   got: %q %v (error %v)\n   expected: %s %v\n", num+1, words, layout, err,
+				testrecord.words, testrecord.layout)
+		}
+	}
+}
+
+// Slot of a file knows the file and its hash, tags leave them empty
+func TestReadPatternWordsFile(t *testing.T) {
+	content := "badger\nturnip\notter\n"
+	fname := filepath.Join(t.TempDir(), "nouns.txt")
+	if err := ioutil.WriteFile(fname, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	_, slots, _, _, err := readPatternWords([]string{"adj", "file:" + fname}, strings.NewReader(testTaggedWordlist), CaseNone)
+	expected := []wordSlot{
+		wordSlot{Name: "adj", Offset: 0, Size: 2},
+		wordSlot{Name: "file:" + fname, Offset: 2, Size: 3, File: fname, SHA256: hex.EncodeToString(sum[:])},
+	}
+	if err != nil || !reflect.DeepEqual(slots, expected) {
+		t.Errorf("got: %v (error %v)\n   expected: %v\n", slots, err, expected)
+	}
+}
+
+type slotEntropy_testrecord struct {
+	words  []string
+	random bool
+	bits   float64
+	fair   bool
+}
+
+func TestSlotEntropy(t *testing.T) {
+	dataset := []slotEntropy_testrecord{
+		slotEntropy_testrecord{words: []string{"Angry", "Sleepy", "Brave", "Calm"}, bits: 2, fair: true},
+		slotEntropy_testrecord{words: []string{"Angry", "Angry", "Sleepy", "Sleepy"}, bits: 1, fair: true},
+		slotEntropy_testrecord{words: []string{"Angry", "Angry", "Sleepy", "Brave"}, bits: 1.5, fair: false},
+		// Random case adds a bit for every word
+		slotEntropy_testrecord{words: []string{"Angry", "Sleepy"}, random: true, bits: 2, fair: true},
+	}
+	for num, testrecord := range dataset {
+		// Slot is in the middle of the list, after a word of another slot
+		words := [][]byte{[]byte("Badger")}
+		for _, word := range testrecord.words {
+			words = append(words, []byte(word))
+		}
+		var lower [][]byte
+		if testrecord.random {
+			lower = lowerForms(words)
+		}
+		bits, fair := slotEntropy(words, lower, wordSlot{Offset: 1, Size: len(testrecord.words)})
+		if math.Abs(bits-testrecord.bits) > 1e-9 || fair != testrecord.fair {
+			t.Errorf("test number %d failed\n   got: %f bits, fair %v\n   expected: %f bits, fair %v\n", num+1, bits, fair,
+				testrecord.bits, testrecord.fair)
+		}
+	}
+}
+
+func TestSampleSlots(t *testing.T) {
+	words := [][]byte{[]byte("Angry"), []byte("Sleepy"), []byte("Badger"), []byte("Turnip"), []byte("Otter"),
+		[]byte("Eats"), []byte("Hugs")}
+	adj := wordSlot{Name: "adj", Offset: 0, Size: 2}
+	noun := wordSlot{Name: "noun", Offset: 2, Size: 3}
+	verb := wordSlot{Name: "verb", Offset: 5, Size: 2}
+	sampler := &Sampler{Words: words, Slots: []wordSlot{adj, noun, verb, noun}}
+	// Numbers are positions within the slot, undo chooses the noun again
+	src := &scriptedSource{numbers: []int{0, 0, -1, 1, 0, 1}}
+	p, err := sampler.Sample(src, 4)
+	if err != nil || p.String() != "AngryTurnipEatsTurnip" || len(src.numbers) != 0 {
+		t.Errorf("got: %v (error %v)\n   expected: AngryTurnipEatsTurnip\n", p, err)
+	}
+}
@@ -0,0 +1,443 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains password policies: limits on length and characters that
+// systems put on passwords. Passphrases are built to pass them, and
+// entropy is counted over the passphrases that can actually be built
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Character classes a policy can require
+const (
+	ClassLower  = "lower"
+	ClassUpper  = "upper"
+	ClassDigit  = "digit"
+	ClassSymbol = "symbol"
+)
+
+var CHAR_CLASSES = []string{ClassLower, ClassUpper, ClassDigit, ClassSymbol}
+
+// Most words a passphrase is planned for when the policy doesn't limit them
+const POLICY_MAX_WORDS = 256
+
+type Policy struct {
+	// Limits on length in characters, 0 if there is none
+	MinLength int
+	MaxLength int
+	// Most words in a passphrase, 0 if there is no limit
+	MaxWords int64
+	// Classes of characters every passphrase must contain, see CHAR_CLASSES
+	Require []string
+	Forbid  []rune
+	// Only ASCII characters from space to tilde are allowed
+	PrintableASCII bool
+}
+
+// Policies that can be given by name instead of a file
+var BUILTIN_POLICIES = map[string]Policy{
+	// Active Directory with complexity requirements wants any three classes
+	// out of four. Requiring these three always passes it, but is stricter
+	// than AD itself. Length of 8 is what domains commonly ask
+	"ad": Policy{MinLength: 8, MaxLength: 256, Require: []string{ClassUpper, ClassLower, ClassDigit}},
+	// WPA2 passphrase
+	"wpa2":     Policy{MinLength: 8, MaxLength: 63, PrintableASCII: true},
+	"legacy32": Policy{MaxLength: 32, PrintableASCII: true},
+}
+
+func validCharClass(class string) bool {
+	for _, c := range CHAR_CLASSES {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func inClass(c rune, class string) bool {
+	switch class {
+	case ClassLower:
+		return unicode.IsLower(c)
+	case ClassUpper:
+		return unicode.IsUpper(c)
+	case ClassDigit:
+		return unicode.IsDigit(c)
+	case ClassSymbol:
+		return unicode.IsPunct(c) || unicode.IsSymbol(c)
+	}
+	return false
+}
+
+// ASCII characters of the class, to draw required characters from
+func classChars(class string) []rune {
+	ret := make([]rune, 0)
+	for c := rune(0x21); c < 0x7F; c++ {
+		if inClass(c, class) {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+func (pol *Policy) allows(c rune) bool {
+	if pol.PrintableASCII && (c < 0x20 || c > 0x7E) {
+		return false
+	}
+	for _, f := range pol.Forbid {
+		if c == f {
+			return false
+		}
+	}
+	return true
+}
+
+func (pol *Policy) allowsString(s string) bool {
+	for _, c := range s {
+		if !pol.allows(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Characters of set that the policy allows
+func (pol *Policy) allowedChars(set []rune) []rune {
+	ret := make([]rune, 0, len(set))
+	for _, c := range set {
+		if pol.allows(c) {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// Reads policy from a file, or takes a built-in one by name
+func loadPolicy(spec string) (*Policy, error) {
+	if pol, ok := BUILTIN_POLICIES[spec]; ok {
+		return &pol, nil
+	}
+	f, err := os.Open(spec)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readPolicy(f)
+}
+
+// Names of built-in policies, sorted
+func builtinPolicyNames() []string {
+	ret := make([]string, 0, len(BUILTIN_POLICIES))
+	for name := range BUILTIN_POLICIES {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Reads policy file: one setting per line, key followed by its value.
+// Keys are "min-length", "max-length", "max-words", "require" with
+// classes separated by spaces, "forbid" with characters written together
+// and "printable-ascii" that has no value
+func readPolicy(rd io.Reader) (*Policy, error) {
+	pol := new(Policy)
+	sc := bufio.NewScanner(rd)
+	lineNum := 0
+	for sc.Scan() {
+		lineNum++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		key := fields[0]
+		value := strings.TrimSpace(line[len(key):])
+		var err error
+		switch key {
+		case "min-length":
+			pol.MinLength, err = strconv.Atoi(value)
+		case "max-length":
+			pol.MaxLength, err = strconv.Atoi(value)
+		case "max-words":
+			pol.MaxWords, err = strconv.ParseInt(value, 10, 64)
+		case "require":
+			for _, class := range fields[1:] {
+				if !validCharClass(class) {
+					err = fmt.Errorf("unknown character class \"%s\"", class)
+					break
+				}
+				pol.Require = append(pol.Require, class)
+			}
+		case "forbid":
+			pol.Forbid = append(pol.Forbid, []rune(value)...)
+		case "printable-ascii":
+			pol.PrintableASCII = true
+			if value != "" {
+				err = fmt.Errorf("\"printable-ascii\" takes no value")
+			}
+		default:
+			err = fmt.Errorf("unknown line")
+		}
+		if err == nil && (pol.MinLength < 0 || pol.MaxLength < 0 || pol.MaxWords < 0) {
+			err = fmt.Errorf("limit can't be negative")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err.Error())
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if pol.MaxLength > 0 && pol.MinLength > pol.MaxLength {
+		return nil, fmt.Errorf("minimum length %d is greater than maximum length %d", pol.MinLength, pol.MaxLength)
+	}
+	return pol, nil
+}
+
+// Whether the word has a character of the class in every form it appears
+// in passphrases
+func wordHasClass(word []byte, class string, mixed bool) bool {
+	has := func(form []byte) bool {
+		for _, c := range string(form) {
+			if inClass(c, class) {
+				return true
+			}
+		}
+		return false
+	}
+	return has(word) && (!mixed || has(lowerForm(word)))
+}
+
+// What passphrase consists of besides the words
+type policyLayout struct {
+	Delimiter  string
+	Delimiters []rune
+	Insert     []rune
+	// Characters the passphrase ends with, one drawn from each set
+	Required [][]rune
+}
+
+// Length in characters of everything but the words
+func (l *policyLayout) extraLength(numWords int64) int {
+	n := 0
+	if numWords > 1 {
+		if l.Delimiters != nil {
+			n = int(numWords - 1)
+		} else {
+			n = int(numWords-1) * utf8.RuneCountInString(l.Delimiter)
+		}
+	}
+	if l.Insert != nil {
+		n++
+	}
+	return n + len(l.Required)
+}
+
+// Bits of entropy of everything but the words
+func (l *policyLayout) extraEntropy(numWords int64) float64 {
+	return specialsEntropy(l.Delimiters, l.Insert, numWords) + requiredEntropy(l.Required)
+}
+
+// Bits added by one character drawn from each set
+func requiredEntropy(sets [][]rune) float64 {
+	bits := 0.0
+	for _, set := range sets {
+		bits = bits + math.Log2(float64(len(set)))
+	}
+	return bits
+}
+
+// Finds the classes that passphrases don't always contain, and sets of
+// characters to draw them from. Class is always there if every word has it
+// in every form, if the inserted character has it, or if every separator
+// has it and there are at least 2 words. Returns whether passphrases need
+// at least 2 words for that reason
+func (pol *Policy) requiredSets(words [][]byte, mixed bool, l *policyLayout) ([][]rune, bool, error) {
+	sets := make([][]rune, 0)
+	needSeparators := false
+	for _, class := range pol.Require {
+		allIn := func(set []rune) bool {
+			for _, c := range set {
+				if !inClass(c, class) {
+					return false
+				}
+			}
+			return len(set) > 0
+		}
+		if l.Insert != nil && allIn(l.Insert) {
+			continue
+		}
+		inWords := true
+		for _, word := range words {
+			if !wordHasClass(word, class, mixed) {
+				inWords = false
+				break
+			}
+		}
+		if inWords {
+			continue
+		}
+		if (l.Delimiters != nil && allIn(l.Delimiters)) ||
+			(l.Delimiters == nil && wordHasClass([]byte(l.Delimiter), class, false)) {
+			needSeparators = true
+			continue
+		}
+		set := pol.allowedChars(classChars(class))
+		if len(set) == 0 {
+			return nil, false, fmt.Errorf("all characters of class \"%s\" are forbidden", class)
+		}
+		sets = append(sets, set)
+	}
+	return sets, needSeparators, nil
+}
+
+// Keeps only the words the policy allows in every form they appear in.
+// Returns positions of kept words in the list
+func (pol *Policy) allowedWords(words [][]byte, mixed bool) []int {
+	ret := make([]int, 0, len(words))
+	for i, word := range words {
+		if pol.allowsString(string(word)) && (!mixed || pol.allowsString(string(lowerForm(word)))) {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// Number of words and limits on their total length in characters that
+// passphrases are built from under a policy
+type policyPlan struct {
+	NumWords int64
+	// Passphrases whose words are not within these limits are chosen
+	// again. MaxLen is 0 if there is no limit
+	MinLen int
+	MaxLen int
+	// Bits of entropy of the words, and of the whole passphrase
+	WordsEntropy float64
+	Entropy      float64
+	// log2 of the share of passphrases that are within the limits
+	Share float64
+}
+
+// Finds the fewest words that reach target bits within the policy, or
+// the plan with the most bits if none does. If numWords is not 0, plans
+// for that many words only. Entropy is counted over passphrases that are
+// within the length limits, see lengthHistogram. Returns false if no
+// passphrase fits the policy
+func (pol *Policy) plan(words [][]byte, caseMode string, l *policyLayout, usable func(int) int,
+	minWords int64, numWords int64, target float64) (policyPlan, bool) {
+	maxWords := pol.MaxWords
+	if maxWords == 0 {
+		maxWords = POLICY_MAX_WORDS
+	}
+	if numWords != 0 {
+		if numWords < minWords {
+			return policyPlan{}, false
+		}
+		minWords, maxWords = numWords, numWords
+	}
+	words = words[:usable(len(words))]
+	var lower [][]byte
+	if caseMode == CaseRandom {
+		lower = lowerForms(words)
+	}
+	h := newLengthHistogram(words, lower)
+	best := policyPlan{}
+	found := false
+	for n := minWords; n <= maxWords; n++ {
+		extra := l.extraLength(n)
+		if pol.MaxLength > 0 && extra+int(n)*h.shortest() > pol.MaxLength {
+			// More words can only be longer
+			break
+		}
+		lo, hi := pol.MinLength-extra, math.MaxInt32
+		if pol.MaxLength > 0 {
+			hi = pol.MaxLength - extra
+		}
+		bits, share, ok := h.entropy(n, lo, hi)
+		if !ok {
+			continue
+		}
+		p := policyPlan{NumWords: n, WordsEntropy: bits, Entropy: bits + l.extraEntropy(n), Share: share}
+		if lo > 0 {
+			p.MinLen = lo
+		}
+		if pol.MaxLength > 0 {
+			p.MaxLen = hi
+		}
+		if found && pol.MaxLength == 0 && p.Entropy <= best.Entropy {
+			// Words add nothing, so more of them won't reach the target
+			break
+		}
+		if !found || p.Entropy > best.Entropy {
+			best = p
+			found = true
+		}
+		if p.Entropy >= target {
+			return p, true
+		}
+	}
+	return best, found
+}
+
+// Checks the finished passphrase against the policy
+func (pol *Policy) check(pass []byte) error {
+	n := utf8.RuneCount(pass)
+	if n < pol.MinLength {
+		return fmt.Errorf("passphrase is %d characters long, shorter than %d", n, pol.MinLength)
+	}
+	if pol.MaxLength > 0 && n > pol.MaxLength {
+		return fmt.Errorf("passphrase is %d characters long, longer than %d", n, pol.MaxLength)
+	}
+	for _, c := range string(pass) {
+		if !pol.allows(c) {
+			return fmt.Errorf("passphrase has forbidden character")
+		}
+	}
+	for _, class := range pol.Require {
+		if !wordHasClass(pass, class, false) {
+			return fmt.Errorf("passphrase has no characters of class \"%s\"", class)
+		}
+	}
+	return nil
+}
+
+// Keeps the words at the given positions, and counts them again in
+// dupTracker. Dice codes printed in the wordlist no longer match positions
+// once words are dropped, so they are dropped too
+func keepWords(words [][]byte, codes []DiceCode, dupTracker map[string]int, positions []int) ([][]byte, []DiceCode) {
+	if len(positions) == len(words) {
+		return words, codes
+	}
+	kept := make([][]byte, len(positions))
+	for word := range dupTracker {
+		delete(dupTracker, word)
+	}
+	for j, i := range positions {
+		kept[j] = words[i]
+		dupTracker[string(words[i])]++
+	}
+	return kept, make([]DiceCode, len(kept))
+}
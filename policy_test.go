@@ -0,0 +1,157 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type readPolicy_testrecord struct {
+	input  string
+	pol    *Policy
+	hasErr bool
+}
+
+func TestReadPolicy(t *testing.T) {
+	dataset := []readPolicy_testrecord{
+		readPolicy_testrecord{input: "# legacy\nmin-length 8\nmax-length 32\nmax-words 4\nrequire digit symbol\nforbid \"'\nprintable-ascii\n",
+			pol: &Policy{MinLength: 8, MaxLength: 32, MaxWords: 4, Require: []string{ClassDigit, ClassSymbol},
+				Forbid: []rune{'"', '\''}, PrintableASCII: true}},
+		readPolicy_testrecord{input: "require digit\nrequire upper\n", pol: &Policy{Require: []string{ClassDigit, ClassUpper}}},
+		readPolicy_testrecord{input: "require digits\n", hasErr: true},
+		readPolicy_testrecord{input: "max-length -1\n", hasErr: true},
+		readPolicy_testrecord{input: "min-length 10\nmax-length 8\n", hasErr: true},
+		readPolicy_testrecord{input: "printable-ascii yes\n", hasErr: true},
+		readPolicy_testrecord{input: "max-size 8\n", hasErr: true},
+	}
+	for num, testrecord := range dataset {
+		pol, err := readPolicy(strings.NewReader(testrecord.input))
+		if (err != nil) != testrecord.hasErr || (err == nil && !reflect.DeepEqual(pol, testrecord.pol)) {
+			t.Errorf("test number %d failed\n   got: %+v (error %v)\n   expected: %+v\n", num+1, pol, err, testrecord.pol)
+		}
+	}
+}
+
+type requiredSets_testrecord struct {
+	require   []string
+	words     []string
+	delimiter string
+	insert    string
+	// Sizes of the sets passphrases end with a character of
+	sizes          []int
+	needSeparators bool
+}
+
+func TestRequiredSets(t *testing.T) {
+	dataset := []requiredSets_testrecord{
+		requiredSets_testrecord{require: []string{ClassUpper, ClassDigit}, words: []string{"Alpha", "Bravo"}, sizes: []int{10}},
+		// Digit in one word only is not enough
+		requiredSets_testrecord{require: []string{ClassDigit}, words: []string{"r2d2", "alpha"}, sizes: []int{10}},
+		requiredSets_testrecord{require: []string{ClassDigit}, words: []string{"r2d2", "c3po"}, sizes: []int{}},
+		requiredSets_testrecord{require: []string{ClassSymbol}, words: []string{"alpha", "bravo"}, delimiter: "-",
+			sizes: []int{}, needSeparators: true},
+		requiredSets_testrecord{require: []string{ClassSymbol, ClassLower}, words: []string{"ALPHA", "BRAVO"}, insert: "!@",
+			sizes: []int{26}},
+	}
+	for num, testrecord := range dataset {
+		pol := &Policy{Require: testrecord.require}
+		words := make([][]byte, len(testrecord.words))
+		for i, word := range testrecord.words {
+			words[i] = []byte(word)
+		}
+		l := &policyLayout{Delimiter: testrecord.delimiter}
+		if testrecord.insert != "" {
+			l.Insert = []rune(testrecord.insert)
+		}
+		sets, needSeparators, err := pol.requiredSets(words, false, l)
+		sizes := make([]int, len(sets))
+		for i, set := range sets {
+			sizes[i] = len(set)
+		}
+		if err != nil || !reflect.DeepEqual(sizes, testrecord.sizes) || needSeparators != testrecord.needSeparators {
+			t.Errorf("test number %d failed\n   got: %v, %v (error %v)\n   expected: %v, %v\n", num+1, sizes, needSeparators, err, testrecord.sizes, testrecord.needSeparators)
+		}
+	}
+}
+
+type policyPlan_testrecord struct {
+	pol      Policy
+	numWords int64
+	target   float64
+	plan     policyPlan
+	ok       bool
+}
+
+func TestPolicyPlan(t *testing.T) {
+	// 4 words of every length from 1 to 4
+	words := make([][]byte, 0)
+	for n := 1; n <= 4; n++ {
+		for _, c := range "abcd" {
+			words = append(words, []byte(strings.Repeat(string(c), n)))
+		}
+	}
+	usable := func(totalWords int) int {
+		return totalWords
+	}
+	dataset := []policyPlan_testrecord{
+		// Fewest words reaching the target
+		policyPlan_testrecord{pol: Policy{}, target: 12, plan: policyPlan{NumWords: 3, Entropy: 12}, ok: true},
+		// 20 ways to split at most 6 characters between 3 words, out of 64,
+		// with 2 characters left for delimiters. 4 words have no more bits
+		policyPlan_testrecord{pol: Policy{MaxLength: 8}, target: 12,
+			plan: policyPlan{NumWords: 3, MaxLen: 6, Entropy: math.Log2(20 * 64), Share: math.Log2(20.0 / 64)}, ok: true},
+		policyPlan_testrecord{pol: Policy{MinLength: 10}, numWords: 2, target: 12, ok: false},
+		// 10 ways to split exactly 6 characters between 4 words
+		policyPlan_testrecord{pol: Policy{MinLength: 9, MaxLength: 9}, target: 12,
+			plan: policyPlan{NumWords: 4, MinLen: 6, MaxLen: 6, Entropy: math.Log2(10 * 256), Share: math.Log2(10.0 / 256)}, ok: true},
+		policyPlan_testrecord{pol: Policy{MaxLength: 10, MaxWords: 2}, target: 12, plan: policyPlan{NumWords: 2, MaxLen: 9, Entropy: 8}, ok: true},
+	}
+	for num, testrecord := range dataset {
+		l := &policyLayout{Delimiter: "-"}
+		plan, ok := testrecord.pol.plan(words, CaseNone, l, usable, 1, testrecord.numWords, testrecord.target)
+		if ok != testrecord.ok || (ok && (plan.NumWords != testrecord.plan.NumWords || plan.MinLen != testrecord.plan.MinLen ||
+			plan.MaxLen != testrecord.plan.MaxLen || math.Abs(plan.Entropy-testrecord.plan.Entropy) > 1e-9 ||
+			math.Abs(plan.Share-testrecord.plan.Share) > 1e-9)) {
+			t.Errorf("test number %d failed\n   got: %+v, %v\n   expected: %+v, %v\n", num+1, plan, ok, testrecord.plan, testrecord.ok)
+		}
+	}
+}
+
+func TestSampleRequired(t *testing.T) {
+	words := [][]byte{[]byte("alpha"), []byte("bravo")}
+	sampler := &Sampler{Words: words, Delimiter: "-", EntropyPerWord: 1, Insert: []rune("!@"),
+		Required: [][]rune{[]rune("0123456789"), []rune("ABC")}}
+	// Undo when asked for a required character discards the last word and
+	// the inserted character
+	src := &scriptedSource{numbers: []int{0, 1, 1, 1, 7, -1, 0, 0, 2, 3, 2}}
+	p, err := sampler.Sample(src, 2)
+	if err != nil || p.String() != "alpha-alpha!3C" || len(src.numbers) != 0 ||
+		math.Abs(p.Entropy-(2+1+math.Log2(3)+math.Log2(10)+math.Log2(3))) > 1e-9 {
+		t.Errorf("got: %v (error %v)\n", p, err)
+	}
+	pol := &Policy{MinLength: 8, MaxLength: 14, Require: []string{ClassDigit, ClassUpper}, PrintableASCII: true}
+	if err := pol.check(p.Bytes()); err != nil {
+		t.Errorf("passphrase didn't pass the policy: %v\n", err)
+	}
+	pol.Forbid = []rune{'!'}
+	if err := pol.check(p.Bytes()); err == nil {
+		t.Errorf("passphrase with forbidden character passed the policy\n")
+	}
+}
@@ -17,33 +17,96 @@
 package main
 
 import (
+	"bytes"
 	"crypto/rand"
+	"errors"
 	"fmt"
-	"math"
+	"io"
 	"math/big"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+// Source of randomness. Words are chosen by the sampler (see Sampler),
+// sources only produce numbers
 type RndSource interface {
-	SetDelimiter(d string)
+	// Number of words out of totalWords that can be chosen, the first
+	// ones in the wordlist
 	Usable(totalWords int) int
-	Generate(words [][]byte, numWordsToGenerate int64) string
+	// Returns uniformly distributed number in [0, n), where n is the number
+	// of usable words
+	Uniform(n int) (int, error)
+}
+
+// Sources that need to prepare before the first word is chosen, or report
+// after the last one
+type RndSourceWithSession interface {
+	RndSource
+	// Called before numWords words are chosen out of totalWords, for a
+	// passphrase with bits of entropy in words and everything else chosen
+	// at random along with them
+	BeginSession(totalWords int, numWords int64, bits float64) error
+	// Called with the complete passphrase
+	EndSession(p *Passphrase) error
+}
+
+// Sources that number words for the user, told when all words chosen so
+// far are discarded to be chosen again
+type RndSourceWithRestart interface {
+	RndSource
+	Restart()
 }
 
 type RndSourceWithDice interface {
 	RndSource
 	SetDiceFaces(faces int)
+	// Roll this set of dice (see parseDiceSpec) for every word instead of
+	// dice with the same number of faces
+	SetDice(dice []int)
+	// Roll enough dice to cover the whole dictionary, asking to reroll
+	// when the value is out of range, instead of trimming the dictionary
+	SetReroll(reroll bool)
+	// Record how many times each face came up for dice with these labels
+	// (see addDiceStats). Either one label for all dice, or one per die
+	SetDieLabels(labels []string)
+	// Number of faces of every die that is rolled to choose one word
+	Dice(totalWords int) []int
+}
+
+// Sources of randomness other than the operating system's run continuous
+// health tests (see HealthTests) on the values they get, unless disabled
+type RndSourceWithHealthTests interface {
+	RndSource
+	SetHealthTests(enabled bool)
 }
 
 type CryptoPRNGImpl struct {
-	delim string
+	rd *bufferedRandReader
 }
 
 type RealDiceImpl struct {
-	delim string
-	faces int
+	faces  int
+	coins  bool
+	dice   []int
+	reroll bool
+	// Dice rolled for every word of this session, and the limit of
+	// rejection sampling
+	sessionDice []int
+	usable      int
+	limit       int
+	// Rolls that selected every word chosen so far
+	rolls [][]int
+	// Health tests for every kind of dice rolled, by number of faces.
+	// nil if disabled
+	health map[int]*HealthTests
+	// Face counts of this session by die label, nil if not recorded
+	labels []string
+	tally  map[string][]int
+	// Written when the passphrase is complete, nil if not requested
+	transcript     *Transcript
+	transcriptFile string
 }
 
 func NewRndSource(rndSource RandomSource) RndSource {
@@ -51,118 +114,557 @@ func NewRndSource(rndSource RandomSource) RndSource {
 		return new(CryptoPRNGImpl)
 	} else if rndSource == RealDice {
 		return new(RealDiceImpl)
+	} else if rndSource == Coins {
+		// A coin is a die with two faces, heads and tails
+		return &RealDiceImpl{faces: 2, coins: true}
+	} else if rndSource == Cards {
+		return new(CardsImpl)
+	} else if rndSource == ByteStream {
+		return new(ByteStreamImpl)
+	} else if rndSource == Mixed {
+		return new(MixedImpl)
+	} else if rndSource == Seeded {
+		return new(SeededImpl)
+	} else if rndSource == Derived {
+		return NewDerived()
 	}
-	fmt.Printf("Program error: unknown rndSource %d.\n", int(rndSource))
+	fmt.Fprintf(diagOut, "Program error: unknown rndSource %d.\n", int(rndSource))
 	return nil
 }
 
-func (c *CryptoPRNGImpl) SetDelimiter(d string) {
-	c.delim = d
-}
-
 func (c *CryptoPRNGImpl) Usable(totalWords int) int {
 	return totalWords
 }
 
-func (c *CryptoPRNGImpl) Generate(words [][]byte, numWordsToGenerate int64) string {
-	passBuilder := strings.Builder{}
-	for i := int64(0); i < numWordsToGenerate; i++ {
-		chRand, err := cRand_UInt(uint(len(words)))
+func (c *CryptoPRNGImpl) Uniform(n int) (int, error) {
+	if c.rd == nil {
+		c.rd = newSystemRandReader()
+	}
+	chRand, err := uniformLemire(c.rd, uint64(n))
+	if err != nil {
+		return 0, &SourceError{ERROR_CRNG_TOLD_US_TO_FUCKOFF, fmt.Errorf("cryptographic pseudo random generation failed: %s", err.Error())}
+	}
+	return int(chRand), nil
+}
+
+func (r *RealDiceImpl) SetDiceFaces(faces int) {
+	if !r.coins {
+		r.faces = faces
+	}
+}
+
+func (r *RealDiceImpl) SetDice(dice []int) {
+	r.dice = dice
+}
+
+func (r *RealDiceImpl) SetHealthTests(enabled bool) {
+	if enabled {
+		r.health = make(map[int]*HealthTests)
+	} else {
+		r.health = nil
+	}
+}
+
+// Feeds the roll into health tests for dice with that many faces, exits
+// if they fail, since a stuck or mistyped value would make the passphrase
+// predictable
+func (r *RealDiceImpl) checkHealth(faces int, rolled int) {
+	if r.health == nil {
+		return
+	}
+	h, ok := r.health[faces]
+	if !ok {
+		h = NewHealthTests(faces)
+		r.health[faces] = h
+	}
+	if err := h.Feed(rolled - 1); err != nil {
+		fmt.Fprintf(diagOut, "Health test failed for %s: %s.\n", r.diceName(faces), err.Error())
+		fmt.Fprintln(diagOut, "The input looks stuck or biased: check the dice and what you type, then start over.")
+		os.Exit(HEALTH_TEST_FAILED)
+	}
+}
+
+func (r *RealDiceImpl) diceName(faces int) string {
+	if r.coins {
+		return "coins"
+	}
+	return fmt.Sprintf("d%d dice", faces)
+}
+
+func (r *RealDiceImpl) SetDieLabels(labels []string) {
+	r.labels = labels
+	if labels != nil {
+		r.tally = make(map[string][]int)
+	}
+}
+
+// Counts the roll towards the label of die number i (0-based)
+func (r *RealDiceImpl) tallyRoll(i int, faces int, rolled int) {
+	if r.tally == nil {
+		return
+	}
+	label := r.labels[0]
+	if len(r.labels) > 1 {
+		// With --reroll, the dice set is rolled several times per word
+		label = r.labels[i%len(r.labels)]
+	}
+	counts, ok := r.tally[label]
+	if !ok {
+		counts = make([]int, faces)
+		r.tally[label] = counts
+	}
+	if len(counts) != faces {
+		fmt.Fprintf(diagOut, "Die label \"%s\" is used for dice with %d and %d faces.\n", label, len(counts), faces)
+		os.Exit(1)
+	}
+	counts[rolled-1]++
+}
+
+// Adds face counts of this session to the ones recorded earlier
+func (r *RealDiceImpl) saveDiceStats() {
+	labels := make([]string, 0, len(r.tally))
+	for label := range r.tally {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		fname, err := addDiceStats(label, r.tally[label])
 		if err != nil {
-			fmt.Printf("Cryptographic pseudo random generation failed: %s.\n", err.Error())
-			os.Exit(ERROR_CRNG_TOLD_US_TO_FUCKOFF)
-		}
-		cho_word := words[chRand]
-		passBuilder.Write(cho_word)
-		if c.delim != "" && i < (numWordsToGenerate-1) {
-			passBuilder.WriteString(c.delim)
+			fmt.Fprintf(diagOut, "Could not record statistics of die \"%s\": %s.\n", label, err.Error())
+		} else {
+			fmt.Fprintf(diagOut, "Recorded face counts of die \"%s\" in %s.\n", label, fname)
+			// Next session counts its own rolls, these are recorded already
+			delete(r.tally, label)
 		}
 	}
-	return passBuilder.String()
 }
 
-func (r *RealDiceImpl) SetDelimiter(d string) {
-	r.delim = d
+func (r *RealDiceImpl) SetReroll(reroll bool) {
+	r.reroll = reroll
 }
 
-func (r *RealDiceImpl) SetDiceFaces(faces int) {
-	r.faces = faces
+// Computed in integers, as floating point logarithms are not
+// guaranteed to produce 5 rather than 4.999... for 7776 words and 6 faces
+func (r *RealDiceImpl) getDicePerWord(totalWords int) int {
+	dpw := 0
+	for p := r.faces; p <= totalWords; p = p * r.faces {
+		dpw++
+	}
+	return dpw
 }
 
-func (r *RealDiceImpl) getDicePerWord(totalWords int) float64 {
-	fracDicePerWord := math.Log2(float64(totalWords)) / math.Log2(float64(r.faces))
-	return math.Floor(fracDicePerWord)
+func (r *RealDiceImpl) Dice(totalWords int) []int {
+	if r.reroll {
+		// Roll the dice set (or a single die) as many times as needed
+		// for the outcomes to cover all words
+		set := r.dice
+		if set == nil {
+			set = []int{r.faces}
+		}
+		dice := make([]int, 0)
+		for diceOutcomes(dice) < totalWords {
+			dice = append(dice, set...)
+		}
+		return dice
+	}
+	if r.dice != nil {
+		return r.dice
+	}
+	dpw := r.getDicePerWord(totalWords)
+	dice := make([]int, dpw)
+	for i := range dice {
+		dice[i] = r.faces
+	}
+	return dice
 }
 
+// Number of different outcomes of rolling these dice
+func diceOutcomes(dice []int) int {
+	ret := 1
+	for _, faces := range dice {
+		ret = ret * faces
+	}
+	return ret
+}
+
+// When dice have more outcomes than there are words, some outcomes
+// are rejected (see chooseWord) and the whole dictionary is usable.
+// Otherwise, only as many words as there are outcomes can be used
 func (r *RealDiceImpl) Usable(totalWords int) int {
-	dpw := r.getDicePerWord(totalWords)
-	return int(math.Pow(float64(r.faces), dpw))
+	outcomes := diceOutcomes(r.Dice(totalWords))
+	if outcomes > totalWords {
+		return totalWords
+	}
+	return outcomes
 }
 
-// needed to write my wrapped, because Scanln with a *int
-// behaves stupid
-func readInt(greeting string) (int, error) {
-	fmt.Printf(greeting)
-	val := ""
-	var err error
-	var ret int
-	_, err = fmt.Scanln(&val)
+// All interactive input from standard input is read through the same
+// buffered reader, so that no input buffered by one reader is lost to another
+var stdinReader *secretReader = newSecretReader(os.Stdin)
+
+// Dice rolls, coin flips and cards are read through it. It reads standard
+// input unless replaced by a file with scripted input (see SetInputFile)
+var inputReader *secretReader = stdinReader
+
+// Typical size of a line of input, longer lines get a larger buffer
+const INPUT_LINE_SIZE = 256
+
+// Reads dice rolls, coin flips and cards from a file instead of standard
+// input, which allows to script generation from physical sources
+func SetInputFile(fname string) {
+	f, err := os.Open(fname)
 	if err != nil {
-		return 0, err
+		fmt.Fprintf(diagOut, "An error has occured while trying to read %s: %s\n", fname, err)
+		os.Exit(1)
 	}
-	ret, err = strconv.Atoi(val)
-	if err != nil {
-		return 0, err
+	inputReader = newSecretReader(f)
+}
+
+// Reads one line of user input, without the line ending, into a buffer
+// that is released with releaseSecret. Input ending before passphrase is
+// complete can't be recovered from, the program exits instead of asking
+// again forever
+func readSecretLine(greeting string) []byte {
+	return readSecretLineFrom(inputReader, greeting)
+}
+
+// Same as readSecretLine, but reads from the given reader
+func readSecretLineFrom(rd *secretReader, greeting string) []byte {
+	fmt.Fprint(diagOut, greeting)
+	line, err := rd.appendLine(newSecret(INPUT_LINE_SIZE))
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		releaseSecret(line)
+		fmt.Fprintf(diagOut, "\nCould not read input: %s.\n", err.Error())
+		os.Exit(ERROR_INPUT_ENDED)
 	}
-	return ret, nil
+	return bytes.TrimRight(line, "\r\n")
 }
 
-func (r *RealDiceImpl) chooseWord(words [][]byte, limit int, dicePerWord int) int {
-	ret := 0
-	for {
-		ret = 0
-		for i := 0; i < dicePerWord; i++ {
-			rolled := 0
-			for (rolled < 1) || (rolled > r.faces) {
-				var err error
-				rolled, err = readInt(fmt.Sprintf("What number shows dice number %d? ", i+1))
-				if err != nil {
-					fmt.Printf("The value was not valid. %s\n", err.Error())
-					rolled = 0
-				} else if (rolled < 1) || (rolled > r.faces) {
-					fmt.Printf("Value out of range: %d, should be >=%d and <=%d\n", rolled, 1, r.faces)
-					rolled = 0
-				}
-				ret = ret + int(math.Pow(float64(r.faces), float64(i-1)))*rolled
+// Heads is the first face of a coin, tails is the second one
+func parseCoinSide(side []byte) (int, error) {
+	if bytes.EqualFold(side, []byte("H")) || bytes.EqualFold(side, []byte("HEADS")) {
+		return 1, nil
+	}
+	if bytes.EqualFold(side, []byte("T")) || bytes.EqualFold(side, []byte("TAILS")) {
+		return 2, nil
+	}
+	return 0, errors.New("neither heads (H) nor tails (T)")
+}
+
+func isUndoCommand(line []byte) bool {
+	line = bytes.TrimSpace(line)
+	return bytes.EqualFold(line, []byte("u")) || bytes.EqualFold(line, []byte("undo"))
+}
+
+// Parses decimal number typed for a die, unlike strconv.Atoi it makes no
+// string out of it
+func parseDieValue(token []byte) (int, error) {
+	if len(token) == 0 || len(token) > 9 {
+		return 0, errors.New("not a number")
+	}
+	v := 0
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return 0, errors.New("not a number")
+		}
+		v = v*10 + int(c-'0')
+	}
+	return v, nil
+}
+
+// Parses values typed for dice with the given faces, in order. Values may
+// be separated by spaces, dashes or commas. When every die has at most
+// 9 faces, values may also be typed without separators, as in "35162".
+// Coins take H and T the same way. Returns fewer values than there are
+// dice if fewer were typed, but never more. Errors name the die by its
+// number, first being the number of the first die, and never repeat what
+// was typed
+func parseRolls(line []byte, faces []int, first int, coins bool) ([]int, error) {
+	tokens := bytes.FieldsFunc(line, func(c rune) bool {
+		return c == ' ' || c == '\t' || c == '-' || c == ','
+	})
+	compact := true
+	for _, f := range faces {
+		if f > 9 {
+			compact = false
+		}
+	}
+	if compact && len(tokens) == 1 && len(tokens[0]) > 1 {
+		// Unless it's "heads" or "tails" spelled out
+		if _, err := parseCoinSide(tokens[0]); !coins || err != nil {
+			digits := tokens[0]
+			tokens = make([][]byte, len(digits))
+			for i := range digits {
+				tokens[i] = digits[i : i+1]
 			}
 		}
-		if ret < limit {
-			break
+	}
+	if len(tokens) > len(faces) {
+		return nil, fmt.Errorf("got %d values, but only %d are needed", len(tokens), len(faces))
+	}
+	rolls := make([]int, 0, len(tokens))
+	for i, token := range tokens {
+		var rolled int
+		var err error
+		if coins {
+			rolled, err = parseCoinSide(token)
 		} else {
-			fmt.Printf("Value out of range. Please roll dice again.")
+			rolled, err = parseDieValue(token)
+		}
+		if err != nil && coins {
+			return nil, fmt.Errorf("invalid value for coin %d, should be heads (H) or tails (T)", first+i)
+		}
+		if err != nil || (rolled < 1) || (rolled > faces[i]) {
+			return nil, fmt.Errorf("invalid value for die %d, should be from 1 to %d", first+i, faces[i])
 		}
+		rolls = append(rolls, rolled)
+	}
+	return rolls, nil
+}
+
+// Asks for the values shown by the dice, which can be typed all on one line
+// or over several lines. Returns nil if the user asked to undo before typing
+// any value, typing undo after some values discards just these values.
+// The first die has number first among all dice rolled, which selects
+// its label
+func (r *RealDiceImpl) readRolls(first int, dice []int) []int {
+	rolls := make([]int, 0, len(dice))
+	for len(rolls) < len(dice) {
+		var prompt string
+		if len(rolls) > 0 {
+			prompt = fmt.Sprintf("%d more: ", len(dice)-len(rolls))
+		} else if r.coins {
+			prompt = fmt.Sprintf("Flip %d coins and type the sides they show (H/T): ", len(dice))
+		} else {
+			prompt = fmt.Sprintf("Roll %s and type the numbers they show, in order: ", diceSpecString(dice))
+		}
+		line := readSecretLine(prompt)
+		if isUndoCommand(line) {
+			releaseSecret(line)
+			if len(rolls) == 0 {
+				return nil
+			}
+			fmt.Fprintln(diagOut, "Discarded the values typed for these dice.")
+			wipeInts(rolls)
+			rolls = rolls[:0]
+			continue
+		}
+		typed, err := parseRolls(line, dice[len(rolls):], len(rolls)+1, r.coins)
+		releaseSecret(line)
+		if err != nil {
+			fmt.Fprintf(diagOut, "The value was not valid. %s\n", err.Error())
+			continue
+		}
+		rolls = append(rolls, typed...)
+		wipeInts(typed)
+	}
+	for i, faces := range dice {
+		r.checkHealth(faces, rolls[i])
+		r.tallyRoll(first+i, faces, rolls[i])
+	}
+	return rolls
+}
+
+// Returns the value of dice rolled (1-based numbers in rolls) as a number
+// in mixed radix, the first die being the most significant digit. This
+// matches the order in which diceware dictionaries list their codes, so
+// "11111" is 0, "11112" is 1 and "66666" is 7775
+func diceValue(rolls []int, dice []int) int {
+	ret := 0
+	for i, rolled := range rolls {
+		ret = ret*dice[i] + (rolled - 1)
 	}
 	return ret
 }
 
-func (r *RealDiceImpl) Generate(words [][]byte, numWordsToGenerate int64) string {
-	passBuilder := strings.Builder{}
-	totalWords := len(words)
-	dpw := int(r.getDicePerWord(totalWords))
-	usableWordsNum := r.Usable(totalWords)
-	for i := int64(0); i < numWordsToGenerate; i++ {
-		fmt.Printf("Generating word number %d:\n", i+1)
-		cho_word := words[r.chooseWord(words, usableWordsNum, dpw)]
-		passBuilder.Write(cho_word)
-		if r.delim != "" && i < (numWordsToGenerate-1) {
-			passBuilder.WriteString(r.delim)
+// Rolls the dice until their value is below limit, which is a multiple
+// of the number of usable words n, so that the remainder of division by n
+// is uniformly distributed (rejection sampling). Returns ErrUndo if the
+// user asked to choose the previous word again. Other choices than that
+// of a word, such as case of the word, take as few of the dice as needed
+func (r *RealDiceImpl) Uniform(n int) (int, error) {
+	dice, limit := r.sessionDice, r.limit
+	if n == r.usable {
+		fmt.Fprintf(diagOut, "Generating word number %d:\n", len(r.rolls)+1)
+	} else {
+		dice, limit = diceForChoice(r.sessionDice, n)
+		if limit == 0 {
+			return 0, &SourceError{DICE_NOT_USABLE, fmt.Errorf("dice have fewer than %d outcomes", n)}
+		}
+		fmt.Fprintf(diagOut, "Choosing one of %d options for word number %d:\n", n, len(r.rolls))
+	}
+	v := limit
+	var rolls []int
+	for v >= limit {
+		rolls = r.readRolls(0, dice)
+		if rolls == nil {
+			if len(r.rolls) > 0 {
+				wipeInts(r.rolls[len(r.rolls)-1])
+				r.rolls = r.rolls[:len(r.rolls)-1]
+				return 0, ErrUndo
+			}
+			fmt.Fprintln(diagOut, "There is no previous word to undo.")
+			v = limit
+			continue
+		}
+		v = diceValue(rolls, dice)
+		if v >= limit {
+			wipeInts(rolls)
+			if r.coins {
+				fmt.Fprintln(diagOut, "Value out of range. Please flip coins again.")
+			} else {
+				fmt.Fprintln(diagOut, "Value out of range. Please roll dice again.")
+			}
+		}
+	}
+	if n == r.usable {
+		r.rolls = append(r.rolls, rolls)
+	} else {
+		wipeInts(rolls)
+	}
+	return v % n, nil
+}
+
+// The first dice of the set that have at least n outcomes, and the limit
+// their value must be below, 0 if the whole set has fewer outcomes
+func diceForChoice(dice []int, n int) ([]int, int) {
+	outcomes := 1
+	for i, faces := range dice {
+		outcomes = outcomes * faces
+		if outcomes >= n {
+			return dice[:i+1], (outcomes / n) * n
+		}
+	}
+	return dice, 0
+}
+
+func (r *RealDiceImpl) BeginSession(totalWords int, numWords int64, bits float64) error {
+	r.sessionDice = r.Dice(totalWords)
+	outcomes := diceOutcomes(r.sessionDice)
+	r.usable = r.Usable(totalWords)
+	r.limit = (outcomes / r.usable) * r.usable
+	r.rolls = make([][]int, 0, numWords)
+	if r.limit != outcomes {
+		expectedRolls := float64(len(r.sessionDice)) * float64(outcomes) / float64(r.limit)
+		if r.coins {
+			fmt.Fprintf(diagOut, "Flipping %d coins per word, with reflips the expected number of flips per word is %.2f.\n", len(r.sessionDice), expectedRolls)
+		} else {
+			fmt.Fprintf(diagOut, "Rolling %d dice per word, with rerolls the expected number of rolls per word is %.2f.\n", len(r.sessionDice), expectedRolls)
+		}
+	}
+	fmt.Fprintln(diagOut, "Type \"undo\" instead of values to choose the previous word again.")
+	return nil
+}
+
+// Writes transcript of the session into fname once the passphrase is
+// complete. Information about the wordlist must already be filled in
+func (r *RealDiceImpl) SetTranscript(t *Transcript, fname string) {
+	r.transcript = t
+	r.transcriptFile = fname
+}
+
+// Warns about biased dice and records face counts, once all dice were rolled
+func (r *RealDiceImpl) finishSession() {
+	if r.health != nil {
+		allFaces := make([]int, 0, len(r.health))
+		for faces := range r.health {
+			allFaces = append(allFaces, faces)
+		}
+		sort.Ints(allFaces)
+		for _, faces := range allFaces {
+			r.health[faces].WarnIfBiased(r.diceName(faces))
+		}
+	}
+	if r.tally != nil {
+		r.saveDiceStats()
+	}
+}
+
+func (r *RealDiceImpl) EndSession(p *Passphrase) error {
+	r.finishSession()
+	if r.transcript != nil {
+		r.transcript.Coins = r.coins
+		r.transcript.Dice = r.sessionDice
+		r.transcript.Usable = r.usable
+		r.transcript.Delimiter = p.Delimiter
+		r.transcript.Entries = make([]TranscriptEntry, len(p.Indices))
+		for i, idx := range p.Indices {
+			r.transcript.Entries[i] = transcriptEntry(r.rolls[i], r.sessionDice, idx, p.Words[i])
+		}
+		r.transcript.Save(r.transcriptFile)
+		fmt.Fprintf(diagOut, "Transcript was written to %s. It contains the passphrase, keep it safe.\n", r.transcriptFile)
+	}
+	for _, rolls := range r.rolls {
+		wipeInts(rolls)
+	}
+	r.rolls = nil
+	return nil
+}
+
+func (r *RealDiceImpl) Restart() {
+	for _, rolls := range r.rolls {
+		wipeInts(rolls)
+	}
+	r.rolls = r.rolls[:0]
+}
+
+// Largest number of outcomes a dice set may have, so that computations
+// on dice values can't overflow an int even on 32-bit platforms
+const MAX_DICE_OUTCOMES = 1 << 30
+
+// Parses dice set specification such as "1d20,1d12,2d6" into the number
+// of faces of every die in the set, in the order they are to be rolled.
+// The count before "d" may be omitted when it is 1
+func parseDiceSpec(spec string) ([]int, error) {
+	dice := make([]int, 0)
+	outcomes := 1
+	for _, group := range strings.Split(spec, ",") {
+		group = strings.TrimSpace(group)
+		dpos := strings.IndexAny(group, "dD")
+		if dpos < 0 {
+			return nil, fmt.Errorf("\"%s\" is not in NdF form, such as 2d6", group)
+		}
+		count := 1
+		if dpos > 0 {
+			var err error
+			count, err = strconv.Atoi(group[:dpos])
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("\"%s\" has invalid number of dice", group)
+			}
+		}
+		faces, err := strconv.Atoi(group[dpos+1:])
+		if err != nil || faces < 2 {
+			return nil, fmt.Errorf("\"%s\" has invalid number of faces, dice must have at least 2 faces", group)
+		}
+		for i := 0; i < count; i++ {
+			if outcomes > MAX_DICE_OUTCOMES/faces {
+				return nil, fmt.Errorf("\"%s\" has too many dice", spec)
+			}
+			outcomes = outcomes * faces
+			dice = append(dice, faces)
+		}
+	}
+	return dice, nil
+}
+
+// Inverse of parseDiceSpec, consecutive dice with the same number of faces
+// are grouped together
+func diceSpecString(dice []int) string {
+	groups := make([]string, 0)
+	for i := 0; i < len(dice); {
+		j := i
+		for j < len(dice) && dice[j] == dice[i] {
+			j++
 		}
+		groups = append(groups, fmt.Sprintf("%dd%d", j-i, dice[i]))
+		i = j
 	}
-	return passBuilder.String()
+	return strings.Join(groups, ",")
 }
 
 // Wrapper over crypto.rand.Int that uses
-// uint type instead of big.NewInt
+// uint type instead of big.NewInt. Slow, as it allocates for every number,
+// it is kept as reference to check the distribution of uniformLemire against
 func cRand_UInt(num uint) (uint, error) {
 	numBig := big.NewInt(int64(num))
 	chRand, err := rand.Int(rand.Reader, numBig)
@@ -0,0 +1,231 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+type parseDiceSpec_testrecord struct {
+	spec  string
+	dice  []int
+	valid bool
+}
+
+type diceValue_testrecord struct {
+	rolls []int
+	dice  []int
+	value int
+}
+
+type usable_testrecord struct {
+	faces      int
+	dice       []int
+	reroll     bool
+	totalWords int
+	usable     int
+	numDice    int
+}
+
+type parseRolls_testrecord struct {
+	line  string
+	faces []int
+	coins bool
+	rolls []int
+	valid bool
+	// Error, which must not repeat what was typed
+	errText string
+}
+
+func cmpInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseDiceSpec(t *testing.T) {
+	dataset := []parseDiceSpec_testrecord{
+		parseDiceSpec_testrecord{spec: "1d20,1d12,2d6", dice: []int{20, 12, 6, 6}, valid: true},
+		parseDiceSpec_testrecord{spec: "2d10", dice: []int{10, 10}, valid: true},
+		parseDiceSpec_testrecord{spec: "d8, 3D6", dice: []int{8, 6, 6, 6}, valid: true},
+		parseDiceSpec_testrecord{spec: "5x6", valid: false},
+		parseDiceSpec_testrecord{spec: "0d6", valid: false},
+		parseDiceSpec_testrecord{spec: "2d1", valid: false},
+		parseDiceSpec_testrecord{spec: "1d6,", valid: false},
+		parseDiceSpec_testrecord{spec: "100d20", valid: false},
+	}
+	for num, testrecord := range dataset {
+		dice, err := parseDiceSpec(testrecord.spec)
+		if (err == nil) != testrecord.valid || (testrecord.valid && !cmpInts(dice, testrecord.dice)) {
+			t.Errorf("test number %d failed\n   got: %v (error %v)\n   expected: %v\n", num+1, dice, err, testrecord.dice)
+		}
+		if testrecord.valid {
+			again, _ := parseDiceSpec(diceSpecString(dice))
+			if !cmpInts(dice, again) {
+				t.Errorf("test number %d failed: %s does not parse back into %v\n", num+1, diceSpecString(dice), dice)
+			}
+		}
+	}
+}
+
+func TestDiceValue(t *testing.T) {
+	dataset := []diceValue_testrecord{
+		diceValue_testrecord{rolls: []int{1, 1, 1, 1, 1}, dice: []int{6, 6, 6, 6, 6}, value: 0},
+		diceValue_testrecord{rolls: []int{1, 1, 1, 1, 2}, dice: []int{6, 6, 6, 6, 6}, value: 1},
+		diceValue_testrecord{rolls: []int{1, 1, 1, 2, 1}, dice: []int{6, 6, 6, 6, 6}, value: 6},
+		diceValue_testrecord{rolls: []int{6, 6, 6, 6, 6}, dice: []int{6, 6, 6, 6, 6}, value: 7775},
+		diceValue_testrecord{rolls: []int{20, 12, 6, 6}, dice: []int{20, 12, 6, 6}, value: 8639},
+		diceValue_testrecord{rolls: []int{2, 1, 1, 1}, dice: []int{20, 12, 6, 6}, value: 432},
+	}
+	for num, testrecord := range dataset {
+		v := diceValue(testrecord.rolls, testrecord.dice)
+		if v != testrecord.value {
+			t.Errorf("test number %d failed\n   got: %d\n   expected: %d\n", num+1, v, testrecord.value)
+		}
+	}
+}
+
+func TestRealDiceUsable(t *testing.T) {
+	dataset := []usable_testrecord{
+		usable_testrecord{faces: 6, totalWords: 7776, usable: 7776, numDice: 5},
+		usable_testrecord{faces: 6, totalWords: 7775, usable: 1296, numDice: 4},
+		usable_testrecord{faces: 20, totalWords: 8000, usable: 8000, numDice: 3},
+		usable_testrecord{faces: 20, totalWords: 7776, usable: 400, numDice: 2},
+		usable_testrecord{faces: 8, totalWords: 32768, usable: 32768, numDice: 5},
+		usable_testrecord{faces: 6, dice: []int{20, 12, 6, 6}, totalWords: 7776, usable: 7776, numDice: 4},
+		usable_testrecord{faces: 6, dice: []int{10, 10}, totalWords: 1728, usable: 100, numDice: 2},
+		usable_testrecord{faces: 20, reroll: true, totalWords: 7776, usable: 7776, numDice: 3},
+		usable_testrecord{faces: 6, reroll: true, totalWords: 7776, usable: 7776, numDice: 5},
+		usable_testrecord{faces: 6, reroll: true, totalWords: 10042, usable: 10042, numDice: 6},
+		usable_testrecord{faces: 6, dice: []int{10, 10}, reroll: true, totalWords: 1728, usable: 1728, numDice: 4},
+	}
+	for num, testrecord := range dataset {
+		r := new(RealDiceImpl)
+		r.SetDiceFaces(testrecord.faces)
+		r.SetDice(testrecord.dice)
+		r.SetReroll(testrecord.reroll)
+		usable := r.Usable(testrecord.totalWords)
+		numDice := len(r.Dice(testrecord.totalWords))
+		if usable != testrecord.usable || numDice != testrecord.numDice {
+			t.Errorf("test number %d failed\n   got: %d words, %d dice\n   expected: %d words, %d dice\n", num+1, usable, numDice, testrecord.usable, testrecord.numDice)
+		}
+	}
+}
+
+func TestParseRolls(t *testing.T) {
+	d6x5 := []int{6, 6, 6, 6, 6}
+	dataset := []parseRolls_testrecord{
+		parseRolls_testrecord{line: "35162", faces: d6x5, rolls: []int{3, 5, 1, 6, 2}, valid: true},
+		parseRolls_testrecord{line: "3 5 1 6 2", faces: d6x5, rolls: []int{3, 5, 1, 6, 2}, valid: true},
+		parseRolls_testrecord{line: "3-5-1-6-2", faces: d6x5, rolls: []int{3, 5, 1, 6, 2}, valid: true},
+		parseRolls_testrecord{line: "3, 5,1", faces: d6x5, rolls: []int{3, 5, 1}, valid: true},
+		parseRolls_testrecord{line: "", faces: d6x5, rolls: []int{}, valid: true},
+		parseRolls_testrecord{line: "351627", faces: d6x5, valid: false},
+		parseRolls_testrecord{line: "35172", faces: d6x5, valid: false,
+			errText: "invalid value for die 4, should be from 1 to 6"},
+		parseRolls_testrecord{line: "3x", faces: d6x5, valid: false,
+			errText: "invalid value for die 2, should be from 1 to 6"},
+		parseRolls_testrecord{line: "17 12 6 6", faces: []int{20, 12, 6, 6}, rolls: []int{17, 12, 6, 6}, valid: true},
+		parseRolls_testrecord{line: "1712", faces: []int{20, 12, 6, 6}, valid: false},
+		parseRolls_testrecord{line: "HTTH", faces: []int{2, 2, 2, 2}, coins: true, rolls: []int{1, 2, 2, 1}, valid: true},
+		parseRolls_testrecord{line: "h t", faces: []int{2, 2, 2, 2}, coins: true, rolls: []int{1, 2}, valid: true},
+		parseRolls_testrecord{line: "tails", faces: []int{2, 2, 2, 2}, coins: true, rolls: []int{2}, valid: true},
+		parseRolls_testrecord{line: "HXT", faces: []int{2, 2, 2, 2}, coins: true, valid: false,
+			errText: "invalid value for coin 2, should be heads (H) or tails (T)"},
+	}
+	for num, testrecord := range dataset {
+		rolls, err := parseRolls([]byte(testrecord.line), testrecord.faces, 1, testrecord.coins)
+		if (err == nil) != testrecord.valid || (testrecord.valid && !cmpInts(rolls, testrecord.rolls)) ||
+			(testrecord.errText != "" && err.Error() != testrecord.errText) {
+			t.Errorf("test number %d failed\n   got: %v (error %v)\n   expected: %v\n", num+1, rolls, err, testrecord.rolls)
+		}
+	}
+}
+
+// Drives dice source from scripted input, the way --dice-input does
+func TestRealDiceScripted(t *testing.T) {
+	words := make([][]byte, 36)
+	for i := range words {
+		words[i] = []byte(fmt.Sprintf("w%d", i))
+	}
+	script := strings.Join([]string{
+		"11",   // word 1: 0
+		"66",   // word 2: 35...
+		"undo", // ...discarded
+		"7 1",  // invalid, asked again
+		"2-3",  // word 2: 8
+		"3",    // word 3 starts on one line...
+		"u",    // ...but these values are discarded
+		"4",    // word 3 is typed over two lines
+		"4",    // word 3: 21
+	}, "\n") + "\n"
+	saved := inputReader
+	defer func() { inputReader = saved }()
+	inputReader = newSecretReader(strings.NewReader(script))
+
+	r := new(RealDiceImpl)
+	r.SetDiceFaces(6)
+	pass := samplePassphrase(t, r, words, 3, "-")
+	if pass != "w0-w8-w21" {
+		t.Errorf("got passphrase %s, expected w0-w8-w21", pass)
+	}
+}
+
+// Every session records only its own rolls, when several passphrases are
+// generated in one run
+func TestRealDiceStatsEverySession(t *testing.T) {
+	oldConfigHome, had := os.LookupEnv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	defer func() {
+		if had {
+			os.Setenv("XDG_CONFIG_HOME", oldConfigHome)
+		} else {
+			os.Unsetenv("XDG_CONFIG_HOME")
+		}
+	}()
+	savedOut := diagOut
+	defer func() { diagOut = savedOut }()
+	diagOut = ioutil.Discard
+	words := make([][]byte, 36)
+	for i := range words {
+		words[i] = []byte(fmt.Sprintf("w%d", i))
+	}
+	saved := inputReader
+	defer func() { inputReader = saved }()
+	inputReader = newSecretReader(strings.NewReader("1 2\n3 4\n"))
+
+	r := new(RealDiceImpl)
+	r.SetDiceFaces(6)
+	r.SetDieLabels([]string{"red"})
+	first := samplePassphrase(t, r, words, 1, "-")
+	second := samplePassphrase(t, r, words, 1, "-")
+	counts, err := loadDiceStats("red")
+	expected := []int{1, 1, 1, 1, 0, 0}
+	if first != "w1" || second != "w15" || err != nil || !cmpInts(counts, expected) {
+		t.Errorf("got: %s, %s, counts %v (error %v)\n   expected: w1, w15, counts %v\n", first, second, counts, err, expected)
+	}
+}
@@ -0,0 +1,349 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains the sampler that chooses words with numbers from a random
+// source, and the passphrase it produces. Sources only produce uniformly
+// distributed numbers, everything else is done here the same way for
+// all of them
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Returned by interactive sources instead of a number when the user asked
+// to choose the previous word again
+var ErrUndo = errors.New("undo previous word")
+
+// Error of a random source, with the exit code of the program
+type SourceError struct {
+	ExitCode int
+	Err      error
+}
+
+func (e *SourceError) Error() string {
+	return e.Err.Error()
+}
+
+// Generated passphrase
+type Passphrase struct {
+	// Positions of the chosen words in the wordlist
+	Indices []int
+	Words   [][]byte
+	// Dice codes printed in the wordlist next to the chosen words, nil if
+	// the wordlist has none
+	Codes     []DiceCode
+	Delimiter string
+	// What goes before every word, and after the last word as the last
+	// one. Nil if words are just separated by Delimiter
+	Separators [][]byte
+	// Bits of entropy of the whole passphrase
+	Entropy float64
+}
+
+// What goes before word number i, or after the last word if i is
+// the number of words
+func (p *Passphrase) separator(i int) []byte {
+	if p.Separators != nil {
+		return p.Separators[i]
+	}
+	if i == 0 || i == len(p.Words) {
+		return nil
+	}
+	return []byte(p.Delimiter)
+}
+
+func (p *Passphrase) String() string {
+	passBuilder := strings.Builder{}
+	for i, word := range p.Words {
+		passBuilder.Write(p.separator(i))
+		passBuilder.Write(word)
+	}
+	passBuilder.Write(p.separator(len(p.Words)))
+	return passBuilder.String()
+}
+
+// Passphrase in a buffer of its own, unlike a string it can be wiped with
+// releaseSecret once written
+func (p *Passphrase) Bytes() []byte {
+	size := 0
+	for i, word := range p.Words {
+		size = size + len(p.separator(i)) + len(word)
+	}
+	size = size + len(p.separator(len(p.Words)))
+	buf := newSecret(size)
+	for i, word := range p.Words {
+		buf = append(buf, p.separator(i)...)
+		buf = append(buf, word...)
+	}
+	return append(buf, p.separator(len(p.Words))...)
+}
+
+// Undoes the last word, when the user asked to choose it again
+func (p *Passphrase) discardLast() {
+	p.Indices = p.Indices[:len(p.Indices)-1]
+	p.Words = p.Words[:len(p.Words)-1]
+	if p.Separators != nil {
+		p.Separators = p.Separators[:len(p.Words)]
+	}
+	fmt.Fprintf(diagOut, "Word number %d was discarded.\n", len(p.Indices)+1)
+}
+
+// Length of words in characters
+func wordsLength(words [][]byte) int {
+	n := 0
+	for _, word := range words {
+		n = n + utf8.RuneCount(word)
+	}
+	return n
+}
+
+// Discards all words, when they don't fit the length limits
+func (p *Passphrase) restart(src RndSource) {
+	wipeInts(p.Indices)
+	p.Indices = p.Indices[:0]
+	p.Words = p.Words[:0]
+	if p.Separators != nil {
+		p.Separators = p.Separators[:0]
+	}
+	if r, ok := src.(RndSourceWithRestart); ok {
+		fmt.Fprintln(diagOut, "Passphrase would not fit the length limits, choosing all words again.")
+		r.Restart()
+	}
+}
+
+// Forgets which words were chosen. Words themselves belong to the wordlist
+func (p *Passphrase) Wipe() {
+	wipeInts(p.Indices)
+	for i := range p.Words {
+		p.Words[i] = nil
+	}
+	for i := range p.Codes {
+		p.Codes[i] = nil
+	}
+	for i := range p.Separators {
+		wipeBytes(p.Separators[i])
+	}
+}
+
+// Chooses words from a wordlist with numbers from random sources
+type Sampler struct {
+	Words [][]byte
+	// Dice codes of the words, parallel to Words, or nil
+	Codes []DiceCode
+	// Maps numbers from the source to positions in the wordlist (see
+	// checkDiceCodes), nil if they are positions already
+	CodeIndex      []int
+	Delimiter      string
+	EntropyPerWord float64
+	// Case mode. With CaseCamel and CaseRandom Words are capitalized, and
+	// LowerWords has the same words with the first letter in lower case
+	Case       string
+	LowerWords [][]byte
+	// Characters to separate words with at random instead of Delimiter,
+	// and to insert at a random word boundary, nil if not used
+	Delimiters []rune
+	Insert     []rune
+	// Sets to draw characters the passphrase ends with from, one from each,
+	// so that it passes a policy
+	Required [][]rune
+	// Limits on the length of all words together in characters. Passphrases
+	// outside them are discarded and chosen again, MaxWordsLength is 0 if
+	// there are no limits
+	MinWordsLength int
+	MaxWordsLength int
+	// Parts of Words that every word of the passphrase is drawn from in
+	// turn, nil if all words are drawn from all of Words
+	Slots []wordSlot
+}
+
+// Words of a passphrase that doesn't fit the length limits
+var (
+	errTooLong  = errors.New("words are too long")
+	errTooShort = errors.New("words are too short")
+)
+
+func (s *Sampler) word(src RndSource, usable int, num int) (int, error) {
+	if s.Slots != nil {
+		slot := s.Slots[num]
+		v, err := src.Uniform(src.Usable(slot.Size))
+		return slot.Offset + v, err
+	}
+	v, err := src.Uniform(usable)
+	if err != nil {
+		return 0, err
+	}
+	if s.CodeIndex != nil {
+		return s.CodeIndex[v], nil
+	}
+	return v, nil
+}
+
+// Chooses words until p has numWords of them, with their separators if
+// they are chosen at random
+func (s *Sampler) words(src RndSource, usable int, p *Passphrase, numWords int64) error {
+	for int64(len(p.Indices)) < numWords {
+		idx, err := s.word(src, usable, len(p.Indices))
+		if err == ErrUndo && len(p.Indices) > 0 {
+			p.discardLast()
+			continue
+		} else if err != nil {
+			return err
+		}
+		p.Indices = append(p.Indices, idx)
+		word := s.Words[idx]
+		if s.Case == CaseCamel && len(p.Words) == 0 {
+			word = s.LowerWords[idx]
+		}
+		p.Words = append(p.Words, word)
+		if s.MaxWordsLength > 0 && wordsLength(p.Words) > s.MaxWordsLength {
+			return errTooLong
+		}
+		if s.Case == CaseRandom {
+			// Choice of the case comes from the same source as words
+			upper, err := src.Uniform(2)
+			if err == ErrUndo {
+				p.discardLast()
+				continue
+			} else if err != nil {
+				return err
+			}
+			if upper == 0 {
+				p.Words[len(p.Words)-1] = s.LowerWords[idx]
+			}
+		}
+		if p.Separators == nil {
+			continue
+		}
+		var sep []byte
+		if len(p.Words) > 1 && s.Delimiters != nil {
+			d, err := src.Uniform(len(s.Delimiters))
+			if err == ErrUndo {
+				p.discardLast()
+				continue
+			} else if err != nil {
+				return err
+			}
+			sep = []byte(string(s.Delimiters[d]))
+		} else if len(p.Words) > 1 {
+			sep = []byte(s.Delimiter)
+		}
+		p.Separators = append(p.Separators, sep)
+	}
+	return nil
+}
+
+// Adds the separator after the last word, appends a random character of
+// Insert to the separator at a random word boundary, the one after the last
+// word included, and ends the passphrase with a character of every
+// Required set. Leaves p as it was on error
+func (s *Sampler) extras(src RndSource, p *Passphrase) error {
+	p.Separators = append(p.Separators, nil)
+	undo := func(err error) error {
+		p.Separators = p.Separators[:len(p.Words)]
+		return err
+	}
+	pos, before := 0, 0
+	if s.Insert != nil {
+		c, err := src.Uniform(len(s.Insert))
+		if err != nil {
+			return undo(err)
+		}
+		pos, err = src.Uniform(len(p.Words) + 1)
+		if err != nil {
+			return undo(err)
+		}
+		before = len(p.Separators[pos])
+		p.Separators[pos] = append(p.Separators[pos], string(s.Insert[c])...)
+	}
+	last := len(p.Words)
+	for _, set := range s.Required {
+		c, err := src.Uniform(len(set))
+		if err != nil {
+			if s.Insert != nil {
+				p.Separators[pos] = p.Separators[pos][:before]
+			}
+			return undo(err)
+		}
+		p.Separators[last] = append(p.Separators[last], string(set[c])...)
+	}
+	return nil
+}
+
+// Entropy of a passphrase of numWords words, with everything chosen at
+// random along with them
+func (s *Sampler) entropy(numWords int64) float64 {
+	return float64(numWords)*s.EntropyPerWord + specialsEntropy(s.Delimiters, s.Insert, numWords) +
+		requiredEntropy(s.Required)
+}
+
+// Chooses numWords words with numbers from src
+func (s *Sampler) Sample(src RndSource, numWords int64) (*Passphrase, error) {
+	usable := src.Usable(len(s.Words))
+	session, hasSession := src.(RndSourceWithSession)
+	if hasSession {
+		if err := session.BeginSession(len(s.Words), numWords, s.entropy(numWords)); err != nil {
+			return nil, err
+		}
+	}
+	p := &Passphrase{
+		Indices:   make([]int, 0, numWords),
+		Words:     make([][]byte, 0, numWords),
+		Delimiter: s.Delimiter,
+	}
+	if s.Delimiters != nil || s.Insert != nil || s.Required != nil {
+		p.Separators = make([][]byte, 0, numWords+1)
+	}
+	for {
+		err := s.words(src, usable, p, numWords)
+		if err == nil && wordsLength(p.Words) < s.MinWordsLength {
+			err = errTooShort
+		}
+		if err == errTooLong || err == errTooShort {
+			p.restart(src)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if p.Separators == nil {
+			break
+		}
+		err = s.extras(src, p)
+		if err == ErrUndo && len(p.Indices) > 0 {
+			p.discardLast()
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		break
+	}
+	if s.Codes != nil {
+		p.Codes = make([]DiceCode, len(p.Indices))
+		for i, idx := range p.Indices {
+			p.Codes[i] = s.Codes[idx]
+		}
+	}
+	p.Entropy = s.entropy(numWords)
+	if hasSession {
+		if err := session.EndSession(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
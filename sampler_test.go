@@ -0,0 +1,117 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+type sampler_testrecord struct {
+	// Numbers the source produces, -1 stands for undo
+	numbers   []int
+	numWords  int64
+	codeIndex []int
+	indices   []int
+	pass      string
+}
+
+// Source that produces given numbers, for testing the sampler
+type scriptedSource struct {
+	numbers []int
+	began   bool
+	ended   *Passphrase
+}
+
+func (s *scriptedSource) Usable(totalWords int) int {
+	return totalWords
+}
+
+func (s *scriptedSource) Uniform(n int) (int, error) {
+	if len(s.numbers) == 0 {
+		return 0, errors.New("out of numbers")
+	}
+	v := s.numbers[0]
+	s.numbers = s.numbers[1:]
+	if v < 0 {
+		return 0, ErrUndo
+	}
+	return v, nil
+}
+
+func (s *scriptedSource) BeginSession(totalWords int, numWords int64, bits float64) error {
+	s.began = true
+	return nil
+}
+
+func (s *scriptedSource) EndSession(p *Passphrase) error {
+	s.ended = p
+	return nil
+}
+
+// Chooses words with numbers from src and joins them with delim
+func samplePassphrase(t *testing.T, src RndSource, words [][]byte, numWords int64, delim string) string {
+	sampler := &Sampler{Words: words, Delimiter: delim}
+	p, err := sampler.Sample(src, numWords)
+	if err != nil {
+		t.Fatalf("sampling failed: %s", err.Error())
+	}
+	return p.String()
+}
+
+func TestSampler(t *testing.T) {
+	words := [][]byte{[]byte("alpha"), []byte("bravo"), []byte("charlie"), []byte("delta")}
+	codes := []DiceCode{DiceCode{1, 1}, DiceCode{1, 2}, DiceCode{2, 1}, DiceCode{2, 2}}
+	dataset := []sampler_testrecord{
+		sampler_testrecord{numbers: []int{0, 3, 1}, numWords: 3, indices: []int{0, 3, 1}, pass: "alpha-delta-bravo"},
+		sampler_testrecord{numbers: []int{2, 3, -1, 0, 1}, numWords: 3, indices: []int{2, 0, 1}, pass: "charlie-alpha-bravo"},
+		sampler_testrecord{numbers: []int{1, -1, -1, 2}, numWords: 2, pass: "", indices: nil},
+		sampler_testrecord{numbers: []int{0, 1}, numWords: 2, codeIndex: []int{3, 2, 1, 0}, indices: []int{3, 2}, pass: "delta-charlie"},
+		sampler_testrecord{numbers: []int{}, numWords: 0, indices: []int{}, pass: ""},
+	}
+	for num, testrecord := range dataset {
+		src := &scriptedSource{numbers: testrecord.numbers}
+		sampler := &Sampler{Words: words, Codes: codes, CodeIndex: testrecord.codeIndex, Delimiter: "-", EntropyPerWord: 2}
+		p, err := sampler.Sample(src, testrecord.numWords)
+		if testrecord.indices == nil {
+			// Undo with no previous word is an error of the source
+			if err == nil {
+				t.Errorf("test number %d failed: expected an error", num+1)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test number %d failed: %s", num+1, err.Error())
+			continue
+		}
+		if !cmpInts(p.Indices, testrecord.indices) || p.String() != testrecord.pass {
+			t.Errorf("test number %d failed\n   got: %v %s\n   expected: %v %s\n", num+1, p.Indices, p.String(), testrecord.indices, testrecord.pass)
+		}
+		for i, idx := range p.Indices {
+			if string(p.Words[i]) != string(words[idx]) || p.Codes[i].String() != codes[idx].String() {
+				t.Errorf("test number %d failed: word %d does not match its index", num+1, i+1)
+			}
+		}
+		if math.Abs(p.Entropy-2*float64(testrecord.numWords)) > 1e-9 {
+			t.Errorf("test number %d failed: got entropy %f", num+1, p.Entropy)
+		}
+		if !src.began || src.ended != p {
+			t.Errorf("test number %d failed: session was not begun and ended", num+1)
+		}
+	}
+}
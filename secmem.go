@@ -0,0 +1,148 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains buffers for secrets: dice rolls as typed, cards drawn,
+// master passphrase and generated passphrase. They are overwritten once
+// not needed, and with --paranoid also locked in memory, so that they are
+// never written to swap
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Set by --paranoid
+var paranoid bool
+
+// Locking failures are reported once, not for every buffer
+var lockFailureReported bool
+
+// Locks secrets in memory from now on, and keeps them out of core dumps
+func enableParanoid() {
+	paranoid = true
+	if err := disableCoreDumps(); err != nil {
+		fmt.Fprintf(diagOut, "Warning: could not disable core dumps: %s.\n", err.Error())
+	}
+}
+
+// Allocates buffer for a secret of up to size bytes, which is released
+// with releaseSecret
+func newSecret(size int) []byte {
+	b := make([]byte, 0, size)
+	if paranoid && size > 0 {
+		if err := lockMemory(b[:size]); err != nil && !lockFailureReported {
+			fmt.Fprintf(diagOut, "Warning: could not lock secrets in memory, they might be written to swap: %s.\n", err.Error())
+			lockFailureReported = true
+		}
+	}
+	return b
+}
+
+// Overwrites the whole buffer of the secret, including bytes past its
+// length, and unlocks it
+func releaseSecret(b []byte) {
+	b = b[:cap(b)]
+	wipeBytes(b)
+	if paranoid && len(b) > 0 {
+		unlockMemory(b)
+	}
+}
+
+// Appends data to secret b, which is moved to a larger secret buffer when
+// data doesn't fit. The old buffer is released
+func appendSecret(b []byte, data []byte) []byte {
+	if len(b)+len(data) > cap(b) {
+		grown := newSecret(2 * (len(b) + len(data)))
+		grown = append(grown, b...)
+		releaseSecret(b)
+		b = grown
+	}
+	return append(b, data...)
+}
+
+// Overwrites a secret that is not needed anymore
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func wipeInts(v []int) {
+	for i := range v {
+		v[i] = 0
+	}
+}
+
+// Default size of the buffer of secretReader
+const SECRET_READER_SIZE = 4096
+
+// Buffered reader of typed input. Unlike bufio.Reader its buffer is
+// allocated with newSecret, and bytes are overwritten in it as soon as
+// they are read out
+type secretReader struct {
+	rd   io.Reader
+	size int
+	buf  []byte
+	r, w int
+	err  error
+}
+
+func newSecretReader(rd io.Reader) *secretReader {
+	return newSecretReaderSize(rd, SECRET_READER_SIZE)
+}
+
+func newSecretReaderSize(rd io.Reader, size int) *secretReader {
+	return &secretReader{rd: rd, size: size}
+}
+
+// Number of bytes read from the underlying reader but not returned yet
+func (s *secretReader) Buffered() int {
+	return s.w - s.r
+}
+
+// Appends input up to and including the next '\n' to secret line, see
+// appendSecret. Error of the underlying reader, such as io.EOF, is
+// returned once all input before it was returned
+func (s *secretReader) appendLine(line []byte) ([]byte, error) {
+	for {
+		if s.r == s.w {
+			if s.err != nil {
+				return line, s.err
+			}
+			if s.buf == nil {
+				// Not allocated by newSecretReaderSize, as readers of
+				// standard input are created before --paranoid is parsed
+				s.buf = newSecret(s.size)[:s.size]
+			}
+			s.r = 0
+			s.w, s.err = s.rd.Read(s.buf)
+			continue
+		}
+		end := s.w
+		i := bytes.IndexByte(s.buf[s.r:s.w], '\n')
+		if i >= 0 {
+			end = s.r + i + 1
+		}
+		line = appendSecret(line, s.buf[s.r:end])
+		wipeBytes(s.buf[s.r:end])
+		s.r = end
+		if i >= 0 {
+			return line, nil
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+var errNotSupported = errors.New("not supported on this system")
+
+func lockMemory(b []byte) error {
+	return errNotSupported
+}
+
+func unlockMemory(b []byte) error {
+	return errNotSupported
+}
+
+func disableCoreDumps() error {
+	return errNotSupported
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+type readSecretLine_testrecord struct {
+	script string
+	lines  []string
+}
+
+func TestReadSecretLine(t *testing.T) {
+	long := strings.Repeat("3 5 1 6 2 ", 100)
+	dataset := []readSecretLine_testrecord{
+		readSecretLine_testrecord{script: "35162\n", lines: []string{"35162"}},
+		readSecretLine_testrecord{script: "1 2\r\n3 4\n", lines: []string{"1 2", "3 4"}},
+		// Last line may lack line ending
+		readSecretLine_testrecord{script: "undo\n66", lines: []string{"undo", "66"}},
+		// Longer than the buffers of both the reader and the line
+		readSecretLine_testrecord{script: long + "\nAS\n", lines: []string{long, "AS"}},
+	}
+	saved, savedOut := inputReader, diagOut
+	defer func() { inputReader, diagOut = saved, savedOut }()
+	diagOut = ioutil.Discard
+	for num, testrecord := range dataset {
+		inputReader = newSecretReaderSize(strings.NewReader(testrecord.script), 16)
+		for _, expected := range testrecord.lines {
+			line := readSecretLine("")
+			if string(line) != expected {
+				t.Errorf("test number %d failed\n   got: %q\n   expected: %q\n", num+1, line, expected)
+			}
+			releaseSecret(line)
+			if full := line[:cap(line)]; !bytes.Equal(full, make([]byte, len(full))) {
+				t.Errorf("test number %d failed: line was not wiped\n", num+1)
+			}
+		}
+		if !bytes.Equal(inputReader.buf, make([]byte, len(inputReader.buf))) {
+			t.Errorf("test number %d failed: input buffer was not wiped\n", num+1)
+		}
+	}
+}
+
+func TestPassphraseWipe(t *testing.T) {
+	p := &Passphrase{
+		Indices:   []int{3, 0},
+		Words:     [][]byte{[]byte("Dog"), []byte("Cat")},
+		Codes:     []DiceCode{DiceCode{1, 4}, DiceCode{1, 1}},
+		Delimiter: " ",
+	}
+	secret := p.Bytes()
+	if string(secret) != "Dog Cat" {
+		t.Errorf("got %q, expected \"Dog Cat\"", secret)
+	}
+	releaseSecret(secret)
+	p.Wipe()
+	if p.Indices[0] != 0 || p.Words[0] != nil || p.Codes[1] != nil || p.String() != " " {
+		t.Errorf("passphrase was not wiped: %v %v %v", p.Indices, p.Words, p.Codes)
+	}
+}
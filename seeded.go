@@ -0,0 +1,158 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains deterministic random source, which expands a seed with
+// HMAC_DRBG from NIST SP 800-90A. Same seed, wordlist and settings give
+// the same passphrase, which is what test vectors need and what real
+// passphrases must never have
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Bytes are requested from the DRBG in blocks of this size, so that
+// the stream does not depend on how it is read
+const SEEDED_BLOCK_SIZE = sha256.Size
+
+// HMAC_DRBG with SHA-256, without nonce, personalization string,
+// additional input or reseeding
+type hmacDRBG struct {
+	key   []byte
+	value []byte
+}
+
+func newHmacDRBG(seed []byte) *hmacDRBG {
+	d := &hmacDRBG{
+		key:   make([]byte, sha256.Size),
+		value: make([]byte, sha256.Size),
+	}
+	for i := range d.value {
+		d.value[i] = 0x01
+	}
+	d.update(seed)
+	return d
+}
+
+func (d *hmacDRBG) hmac(data ...[]byte) []byte {
+	mac := hmac.New(sha256.New, d.key)
+	for _, b := range data {
+		mac.Write(b)
+	}
+	return mac.Sum(nil)
+}
+
+// HMAC_DRBG_Update, SP 800-90A section 10.1.2.2
+func (d *hmacDRBG) update(provided []byte) {
+	d.key = d.hmac(d.value, []byte{0x00}, provided)
+	d.value = d.hmac(d.value)
+	if len(provided) == 0 {
+		return
+	}
+	d.key = d.hmac(d.value, []byte{0x01}, provided)
+	d.value = d.hmac(d.value)
+}
+
+// HMAC_DRBG_Generate, SP 800-90A section 10.1.2.5
+func (d *hmacDRBG) generate(n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		d.value = d.hmac(d.value)
+		out = append(out, d.value...)
+	}
+	d.update(nil)
+	return out[:n]
+}
+
+// Stream of DRBG output, requested SEEDED_BLOCK_SIZE bytes at a time
+type drbgReader struct {
+	drbg  *hmacDRBG
+	block []byte
+}
+
+func (r *drbgReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.block) == 0 {
+			r.block = r.drbg.generate(SEEDED_BLOCK_SIZE)
+		}
+		copied := copy(p[n:], r.block)
+		r.block = r.block[copied:]
+		n = n + copied
+	}
+	return n, nil
+}
+
+// Words are chosen from the DRBG stream the same way as from a random
+// stream file, see uniformFromBytes
+type SeededImpl struct {
+	seed []byte
+	rd   *drbgReader
+}
+
+func (s *SeededImpl) Usable(totalWords int) int {
+	return totalWords
+}
+
+// Reads the seed as specified by "file:PATH" (whole file) or "env:NAME"
+// (value of environment variable)
+func (s *SeededImpl) LoadSeed(spec string) {
+	var err error
+	if strings.HasPrefix(spec, "file:") {
+		s.seed, err = ioutil.ReadFile(spec[len("file:"):])
+	} else if strings.HasPrefix(spec, "env:") {
+		value, ok := os.LookupEnv(spec[len("env:"):])
+		if !ok {
+			err = fmt.Errorf("environment variable %s is not set", spec[len("env:"):])
+		}
+		s.seed = []byte(value)
+	} else {
+		err = fmt.Errorf("should be file:PATH or env:NAME")
+	}
+	if err == nil && len(s.seed) == 0 {
+		err = fmt.Errorf("seed is empty")
+	}
+	if err != nil {
+		fmt.Fprintf(diagOut, "Can't read seed \"%s\": %s.\n", spec, err.Error())
+		os.Exit(1)
+	}
+	addWarning(WARN_SEEDED_NOT_RANDOM, "Passphrase is generated from a seed and is not random.")
+}
+
+// Passphrases after the first one continue the same stream
+func (s *SeededImpl) BeginSession(totalWords int, numWords int64, bits float64) error {
+	if s.rd == nil {
+		fmt.Fprintln(diagOut, "WARNING: the passphrase is generated from a seed and is NOT RANDOM.")
+		fmt.Fprintln(diagOut, "WARNING: anyone who knows the seed gets the same passphrase. Use it only for testing.")
+		s.rd = &drbgReader{drbg: newHmacDRBG(s.seed)}
+	}
+	return nil
+}
+
+func (s *SeededImpl) Uniform(n int) (int, error) {
+	// DRBG never runs out
+	chRand, _, _ := uniformFromBytes(s.rd, n)
+	return chRand, nil
+}
+
+func (s *SeededImpl) EndSession(p *Passphrase) error {
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains random separators between words and a random character
+// inserted at a word boundary, for sites that want digits and symbols.
+// Their bits count towards entropy, so fewer words are needed
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// Parses set of characters to choose from, every character must be
+// given once
+func parseCharSet(set string) ([]rune, error) {
+	ret := make([]rune, 0, len(set))
+	seen := make(map[rune]bool)
+	for _, c := range set {
+		if seen[c] {
+			return nil, fmt.Errorf("character '%c' is given twice", c)
+		}
+		seen[c] = true
+		ret = append(ret, c)
+	}
+	if len(ret) < 2 {
+		return nil, fmt.Errorf("at least 2 different characters are needed")
+	}
+	return ret, nil
+}
+
+// Bits added to a passphrase of numWords words by separators drawn from
+// delimiters, and by a character from insert put at one of the word
+// boundaries (before the first word, between words or after the last).
+// Either set may be nil. The passphrase can be split back into its parts
+// only if no word contains these characters, see specialInWords
+func specialsEntropy(delimiters []rune, insert []rune, numWords int64) float64 {
+	bits := 0.0
+	if delimiters != nil && numWords > 1 {
+		bits = bits + float64(numWords-1)*math.Log2(float64(len(delimiters)))
+	}
+	if insert != nil && numWords > 0 {
+		bits = bits + math.Log2(float64(len(insert))) + math.Log2(float64(numWords+1))
+	}
+	return bits
+}
+
+// Returns a character of set that occurs in one of words, if any does
+func specialInWords(set []rune, words [][]byte) (rune, bool) {
+	for _, c := range set {
+		for _, word := range words {
+			if bytes.ContainsRune(word, c) {
+				return c, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+type parseCharSet_testrecord struct {
+	set    string
+	chars  []rune
+	hasErr bool
+}
+
+func TestParseCharSet(t *testing.T) {
+	dataset := []parseCharSet_testrecord{
+		parseCharSet_testrecord{set: "0123", chars: []rune{'0', '1', '2', '3'}},
+		parseCharSet_testrecord{set: "!€", chars: []rune{'!', '€'}},
+		parseCharSet_testrecord{set: "1231", hasErr: true},
+		parseCharSet_testrecord{set: "#", hasErr: true},
+	}
+	for num, testrecord := range dataset {
+		chars, err := parseCharSet(testrecord.set)
+		if (err != nil) != testrecord.hasErr || string(chars) != string(testrecord.chars) {
+			t.Errorf("test number %d failed\n   got: %q (error %v)\n   expected: %q\n", num+1, chars, err, testrecord.chars)
+		}
+	}
+}
+
+type sampleSpecials_testrecord struct {
+	delimiters string
+	insert     string
+	// Numbers the source produces, -1 stands for undo
+	numbers []int
+	pass    string
+	// Bits the specials add to the passphrase
+	bits float64
+}
+
+func TestSampleSpecials(t *testing.T) {
+	words := [][]byte{[]byte("alpha"), []byte("bravo"), []byte("charlie")}
+	dataset := []sampleSpecials_testrecord{
+		// Every word but the first is followed by its delimiter
+		sampleSpecials_testrecord{delimiters: "0123", numbers: []int{0, 1, 3, 2, 2}, pass: "alpha3bravo2charlie", bits: 4},
+		// Character, then the boundary to insert it at
+		sampleSpecials_testrecord{insert: "!@", numbers: []int{0, 1, 2, 1, 3}, pass: "alpha-bravo-charlie@", bits: 3},
+		sampleSpecials_testrecord{insert: "!@", numbers: []int{0, 1, 2, 0, 0}, pass: "!alpha-bravo-charlie", bits: 3},
+		sampleSpecials_testrecord{delimiters: "0123", insert: "!@", numbers: []int{0, 1, 3, 2, 2, 0, 1}, pass: "alpha3!bravo2charlie", bits: 7},
+		// Undo when asked for the delimiter discards the word
+		sampleSpecials_testrecord{delimiters: "0123", numbers: []int{0, 1, -1, 2, 1, 1, 0}, pass: "alpha1charlie0bravo", bits: 4},
+		// Undo when asked for the character discards the last word
+		sampleSpecials_testrecord{insert: "!@", numbers: []int{0, 1, 2, -1, 0, 0, 2}, pass: "alpha-bravo-!alpha", bits: 3},
+	}
+	for num, testrecord := range dataset {
+		sampler := &Sampler{Words: words, Delimiter: "-"}
+		if testrecord.delimiters != "" {
+			sampler.Delimiters = []rune(testrecord.delimiters)
+		}
+		if testrecord.insert != "" {
+			sampler.Insert = []rune(testrecord.insert)
+		}
+		src := &scriptedSource{numbers: testrecord.numbers}
+		p, err := sampler.Sample(src, 3)
+		if err != nil || p.String() != testrecord.pass || len(src.numbers) != 0 ||
+			math.Abs(p.Entropy-testrecord.bits) > 1e-9 {
+			t.Errorf("test number %d failed\n   got: %v (error %v)\n   expected: %s, %f bits\n", num+1, p, err, testrecord.pass, testrecord.bits)
+		}
+	}
+}
+
+type specialInWords_testrecord struct {
+	set   string
+	found bool
+}
+
+func TestSpecialInWords(t *testing.T) {
+	words := [][]byte{[]byte("alpha"), []byte("r2d2"), []byte("co-op")}
+	dataset := []specialInWords_testrecord{
+		specialInWords_testrecord{set: "!@#", found: false},
+		specialInWords_testrecord{set: "0123", found: true},
+		specialInWords_testrecord{set: "_-", found: true},
+	}
+	for num, testrecord := range dataset {
+		_, found := specialInWords([]rune(testrecord.set), words)
+		if found != testrecord.found {
+			t.Errorf("test number %d failed\n   got: %v\n   expected: %v\n", num+1, found, testrecord.found)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains random source that reads raw bytes from a file or device,
+// such as a dump from hardware random number generator
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+type ByteStreamImpl struct {
+	fname     string
+	rd        io.Reader
+	bytesUsed int
+	health    *HealthTests
+}
+
+// Opens the stream. "-" stands for standard input
+func (b *ByteStreamImpl) Open(fname string) {
+	b.fname = fname
+	if fname == "-" {
+		b.fname = "standard input"
+		b.rd = bufio.NewReader(os.Stdin)
+		return
+	}
+	f, err := os.Open(fname)
+	if err != nil {
+		fmt.Fprintf(diagOut, "An error has occured while trying to open random source %s: %s\n", fname, err)
+		os.Exit(1)
+	}
+	b.rd = bufio.NewReader(f)
+}
+
+// Must be called after Open
+func (b *ByteStreamImpl) SetHealthTests(enabled bool) {
+	if enabled {
+		b.health = NewHealthTests(256)
+		b.rd = &healthCheckedReader{rd: b.rd, tests: b.health}
+	}
+}
+
+func (b *ByteStreamImpl) Usable(totalWords int) int {
+	return totalWords
+}
+
+func (b *ByteStreamImpl) Uniform(n int) (int, error) {
+	chRand, used, err := uniformFromBytes(b.rd, n)
+	b.bytesUsed = b.bytesUsed + used
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, &SourceError{ERROR_RANDOM_STREAM_EXHAUSTED,
+			fmt.Errorf("random source %s ran out after %d bytes, before passphrase was complete", b.fname, b.bytesUsed)}
+	} else if herr, ok := err.(*HealthTestError); ok {
+		return 0, &SourceError{HEALTH_TEST_FAILED,
+			fmt.Errorf("random source %s failed after %d bytes: %s. The bytes look stuck or biased, the source is not fit for generating passphrases", b.fname, b.bytesUsed, herr.Error())}
+	} else if err != nil {
+		return 0, fmt.Errorf("an error has occured while reading random source %s: %s", b.fname, err.Error())
+	}
+	return chRand, nil
+}
+
+func (b *ByteStreamImpl) BeginSession(totalWords int, numWords int64, bits float64) error {
+	return nil
+}
+
+func (b *ByteStreamImpl) EndSession(p *Passphrase) error {
+	if b.health != nil {
+		b.health.WarnIfBiased("random source " + b.fname)
+	}
+	fmt.Fprintf(diagOut, "Used %d bytes from random source %s.\n", b.bytesUsed, b.fname)
+	return nil
+}
+
+// Reads bytes from rd to produce a uniformly distributed number in [0, n),
+// n must be positive and not exceed 1<<32. Just enough bytes are read
+// to cover n values with a big endian number, values falling into the
+// incomplete range at the top are rejected and more bytes are read.
+// Returns the number and how many bytes were consumed
+func uniformFromBytes(rd io.Reader, n int) (int, int, error) {
+	k := 0
+	outcomes := uint64(1)
+	for outcomes < uint64(n) {
+		outcomes = outcomes << 8
+		k++
+	}
+	limit := (outcomes / uint64(n)) * uint64(n)
+	buf := make([]byte, k)
+	used := 0
+	for {
+		read, err := io.ReadFull(rd, buf)
+		used = used + read
+		if err != nil {
+			return 0, used, err
+		}
+		v := uint64(0)
+		for _, octet := range buf {
+			v = v<<8 | uint64(octet)
+		}
+		if v < limit {
+			return int(v % uint64(n)), used, nil
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type uniformFromBytes_testrecord struct {
+	input  []byte
+	n      int
+	result int
+	used   int
+	err    error
+}
+
+func TestUniformFromBytes(t *testing.T) {
+	dataset := []uniformFromBytes_testrecord{
+		uniformFromBytes_testrecord{input: []byte{0x00, 0x05}, n: 7776, result: 5, used: 2},
+		uniformFromBytes_testrecord{input: []byte{0x1e, 0x60}, n: 7776, result: 0, used: 2},
+		// 0xf300 = 62208 is the first value to be rejected for 7776 words
+		uniformFromBytes_testrecord{input: []byte{0xf3, 0x00, 0x00, 0x01}, n: 7776, result: 1, used: 4},
+		uniformFromBytes_testrecord{input: []byte{0xff}, n: 6, result: 0, used: 1, err: io.EOF},
+		uniformFromBytes_testrecord{input: []byte{0xff, 0xfe}, n: 6, result: 0, used: 2, err: io.EOF},
+		uniformFromBytes_testrecord{input: []byte{0x01}, n: 7776, result: 0, used: 1, err: io.ErrUnexpectedEOF},
+		uniformFromBytes_testrecord{input: []byte{0x01, 0x00, 0x00}, n: 65537, result: 65536, used: 3},
+	}
+	for num, testrecord := range dataset {
+		result, used, err := uniformFromBytes(bytes.NewReader(testrecord.input), testrecord.n)
+		if err != testrecord.err || (err == nil && result != testrecord.result) || used != testrecord.used {
+			t.Errorf("test number %d failed\n   got: %d, %d bytes used, error %v\n   expected: %d, %d bytes used, error %v\n",
+				num+1, result, used, err, testrecord.result, testrecord.used, testrecord.err)
+		}
+	}
+}
+
+// Every byte value that is accepted must map onto each outcome
+// the same number of times
+func TestUniformFromBytesIsUnbiased(t *testing.T) {
+	for _, n := range []int{2, 3, 6, 7, 100, 255} {
+		counts := make([]int, n)
+		accepted := 0
+		for octet := 0; octet < 256; octet++ {
+			v, _, err := uniformFromBytes(bytes.NewReader([]byte{byte(octet)}), n)
+			if err == nil {
+				counts[v]++
+				accepted++
+			}
+		}
+		for v, cnt := range counts {
+			if cnt != accepted/n {
+				t.Errorf("n = %d: value %d was produced %d times, expected %d", n, v, cnt, accepted/n)
+			}
+		}
+	}
+}
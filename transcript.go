@@ -0,0 +1,359 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+// It contains transcripts of dice sessions, which list the rolls of every
+// word and the word they chose, and their replay: recomputing the passphrase
+// from the rolls, so that a second person can audit the mapping without
+// trusting the program run that produced it
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// How the wordlist was chosen, the same way it can be chosen again
+const (
+	TranscriptWordlistName = "wordlist"
+	TranscriptDictFile     = "dictionary"
+)
+
+type Transcript struct {
+	// TranscriptWordlistName or TranscriptDictFile, and the name or
+	// file name respectively
+	WordlistKind string
+	Wordlist     string
+	// SHA-256 of the wordlist file, hex encoded
+	WordlistHash string
+	// Case mode, see CaseNone and others
+	Case  string
+	Coins bool
+	// Dice rolled for every word
+	Dice      []int
+	Usable    int
+	Delimiter string
+	Entries   []TranscriptEntry
+}
+
+// Rolls of one word, and what they selected
+type TranscriptEntry struct {
+	Rolls []int
+	Value int
+	// Position of the word in the wordlist, 0-based
+	Index int
+	Code  string
+	Word  string
+}
+
+// Hashes the wordlist while it is being read
+type wordlistHasher struct {
+	rd     io.Reader
+	hasher hash.Hash
+}
+
+func newWordlistHasher(rd io.Reader) *wordlistHasher {
+	h := sha256.New()
+	return &wordlistHasher{rd: io.TeeReader(rd, h), hasher: h}
+}
+
+func (w *wordlistHasher) Read(p []byte) (int, error) {
+	return w.rd.Read(p)
+}
+
+// Reads whatever the parser left unread and returns hash of the whole file
+func (w *wordlistHasher) Hash() (string, error) {
+	if _, err := io.Copy(ioutil.Discard, w.rd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(w.hasher.Sum(nil)), nil
+}
+
+func transcriptEntry(rolls []int, dice []int, index int, word []byte) TranscriptEntry {
+	return TranscriptEntry{
+		Rolls: rolls,
+		Value: diceValue(rolls, dice),
+		Index: index,
+		Code:  DiceCode(rolls).String(),
+		Word:  string(word),
+	}
+}
+
+func joinRolls(rolls []int) string {
+	s := make([]string, len(rolls))
+	for i, rolled := range rolls {
+		s[i] = strconv.Itoa(rolled)
+	}
+	return strings.Join(s, "-")
+}
+
+func writeTranscript(wr io.Writer, t *Transcript) error {
+	bw := bufio.NewWriter(wr)
+	fmt.Fprintln(bw, "# offend dice transcript: rolls of every word and the word they chose")
+	fmt.Fprintln(bw, "# check it with 'offend replay FILE'. It contains the passphrase, keep it safe")
+	fmt.Fprintf(bw, "%s %s\n", t.WordlistKind, t.Wordlist)
+	fmt.Fprintf(bw, "sha256 %s\n", t.WordlistHash)
+	fmt.Fprintf(bw, "case %s\n", t.Case)
+	fmt.Fprintf(bw, "coins %t\n", t.Coins)
+	fmt.Fprintf(bw, "dice %s\n", diceSpecString(t.Dice))
+	fmt.Fprintf(bw, "usable %d\n", t.Usable)
+	fmt.Fprintf(bw, "delimiter %s\n", strconv.Quote(t.Delimiter))
+	for i, e := range t.Entries {
+		// Words of some wordlists contain spaces, so the word is quoted
+		fmt.Fprintf(bw, "word %d rolls %s value %d index %d code %s chosen %s\n",
+			i+1, joinRolls(e.Rolls), e.Value, e.Index, e.Code, strconv.Quote(e.Word))
+	}
+	return bw.Flush()
+}
+
+// Writes the transcript into a new file, readable only by the user. File
+// that exists already is never overwritten
+func (t *Transcript) Save(fname string) {
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil {
+		err = writeTranscript(f, t)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(fname)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(diagOut, "Could not write transcript %s: %s.\n", fname, err.Error())
+		os.Exit(1)
+	}
+}
+
+// Parses word line. Everything after "chosen" is the quoted word
+func parseTranscriptEntry(line string, num int) (TranscriptEntry, error) {
+	var e TranscriptEntry
+	chosen := strings.Index(line, " chosen ")
+	if chosen < 0 {
+		return e, fmt.Errorf("malformed word line")
+	}
+	fields := strings.Fields(line[:chosen])
+	if len(fields) != 10 || fields[0] != "word" || fields[2] != "rolls" || fields[4] != "value" ||
+		fields[6] != "index" || fields[8] != "code" {
+		return e, fmt.Errorf("malformed word line")
+	}
+	if n, err := strconv.Atoi(fields[1]); err != nil || n != num {
+		return e, fmt.Errorf("expected word number %d, got %s", num, fields[1])
+	}
+	for _, s := range strings.Split(fields[3], "-") {
+		rolled, err := strconv.Atoi(s)
+		if err != nil {
+			return e, fmt.Errorf("malformed rolls \"%s\"", fields[3])
+		}
+		e.Rolls = append(e.Rolls, rolled)
+	}
+	var err error
+	if e.Value, err = strconv.Atoi(fields[5]); err != nil {
+		return e, fmt.Errorf("malformed value \"%s\"", fields[5])
+	}
+	if e.Index, err = strconv.Atoi(fields[7]); err != nil {
+		return e, fmt.Errorf("malformed index \"%s\"", fields[7])
+	}
+	e.Code = fields[9]
+	quoted := strings.TrimSpace(line[chosen+len(" chosen "):])
+	if e.Word, err = strconv.Unquote(quoted); err != nil {
+		return e, fmt.Errorf("malformed word %s", quoted)
+	}
+	return e, nil
+}
+
+// Reads transcript in the format written by writeTranscript
+func readTranscript(rd io.Reader) (*Transcript, error) {
+	t := new(Transcript)
+	sc := bufio.NewScanner(rd)
+	lineNum := 0
+	seen := make(map[string]bool)
+	for sc.Scan() {
+		lineNum++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		key := fields[0]
+		value := strings.TrimSpace(line[len(key):])
+		var err error
+		switch key {
+		case "word":
+			var e TranscriptEntry
+			e, err = parseTranscriptEntry(line, len(t.Entries)+1)
+			t.Entries = append(t.Entries, e)
+		case TranscriptWordlistName, TranscriptDictFile:
+			t.WordlistKind = key
+			t.Wordlist = value
+		case "sha256":
+			t.WordlistHash = value
+		case "case":
+			t.Case = value
+			if !validCaseMode(value) {
+				err = fmt.Errorf("unknown case mode \"%s\"", value)
+			}
+		case "coins":
+			t.Coins, err = strconv.ParseBool(value)
+		case "dice":
+			t.Dice, err = parseDiceSpec(value)
+		case "usable":
+			t.Usable, err = strconv.Atoi(value)
+		case "delimiter":
+			t.Delimiter, err = strconv.Unquote(value)
+		default:
+			err = fmt.Errorf("unknown line")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err.Error())
+		}
+		seen[key] = true
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"sha256", "case", "coins", "dice", "usable", "delimiter"} {
+		if !seen[key] {
+			return nil, fmt.Errorf("\"%s\" line is missing", key)
+		}
+	}
+	if t.WordlistKind == "" {
+		return nil, fmt.Errorf("wordlist is not named")
+	}
+	return t, nil
+}
+
+// Recomputes the words from the rolls in the transcript. Returns the
+// passphrase and a description of every place where the transcript
+// disagrees with the recomputation
+func replayTranscript(t *Transcript, words [][]byte, codes []DiceCode) (string, []string) {
+	mismatches := make([]string, 0)
+	outcomes := diceOutcomes(t.Dice)
+	usable := outcomes
+	if usable > len(words) {
+		usable = len(words)
+	}
+	if usable != t.Usable {
+		mismatches = append(mismatches, fmt.Sprintf("%d words of the wordlist can be used with dice %s, transcript says %d", usable, diceSpecString(t.Dice), t.Usable))
+	}
+	limit := (outcomes / usable) * usable
+	codeIndex, err := checkDiceCodes(codes, t.Dice)
+	if err != nil {
+		codeIndex = nil
+	}
+	chosen := make([]string, 0, len(t.Entries))
+	for i, e := range t.Entries {
+		where := fmt.Sprintf("word %d", i+1)
+		if len(e.Rolls) != len(t.Dice) {
+			mismatches = append(mismatches, fmt.Sprintf("%s: %d rolls, but %d dice are rolled per word", where, len(e.Rolls), len(t.Dice)))
+			continue
+		}
+		valid := true
+		for j, rolled := range e.Rolls {
+			if rolled < 1 || rolled > t.Dice[j] {
+				mismatches = append(mismatches, fmt.Sprintf("%s: die number %d can't show %d", where, j+1, rolled))
+				valid = false
+			}
+		}
+		if !valid {
+			continue
+		}
+		v := diceValue(e.Rolls, t.Dice)
+		if v != e.Value {
+			mismatches = append(mismatches, fmt.Sprintf("%s: rolls have value %d, transcript says %d", where, v, e.Value))
+		}
+		if v >= limit {
+			mismatches = append(mismatches, fmt.Sprintf("%s: value %d is out of range, the dice should have been rolled again", where, v))
+			continue
+		}
+		idx := v % usable
+		if codeIndex != nil {
+			idx = codeIndex[idx]
+		}
+		if idx != e.Index {
+			mismatches = append(mismatches, fmt.Sprintf("%s: rolls select word at index %d, transcript says %d", where, idx, e.Index))
+		}
+		if code := DiceCode(e.Rolls).String(); code != e.Code {
+			mismatches = append(mismatches, fmt.Sprintf("%s: rolls form code %s, transcript says %s", where, code, e.Code))
+		}
+		word := words[idx]
+		if t.Case == CaseCamel && i == 0 {
+			word = lowerForm(word)
+		}
+		if string(word) != e.Word {
+			mismatches = append(mismatches, fmt.Sprintf("%s: rolls select \"%s\", transcript says \"%s\"", where, word, e.Word))
+		}
+		chosen = append(chosen, string(word))
+	}
+	return strings.Join(chosen, t.Delimiter), mismatches
+}
+
+// Replays transcript in fname against its wordlist, or against dictFile
+// if it is not empty. Exits with REPLAY_MISMATCH if anything disagrees
+func ReplayTranscript(fname string, dictFile string) {
+	f, err := os.Open(fname)
+	if err != nil {
+		fmt.Fprintf(diagOut, "An error has occured while trying to read %s: %s\n", fname, err)
+		os.Exit(1)
+	}
+	t, err := readTranscript(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(diagOut, "Transcript %s is not valid: %s.\n", fname, err.Error())
+		os.Exit(1)
+	}
+	if dictFile == "" {
+		if t.WordlistKind == TranscriptWordlistName {
+			dictFile = GetFileNameFromDictName(WORDLIST_DIRECTORY, t.Wordlist)
+		} else {
+			dictFile = t.Wordlist
+		}
+	}
+	hrd := newWordlistHasher(GetReaderForFile(dictFile))
+	// Words must be capitalized the way they were when the transcript
+	// was written
+	words, codes, _, _ := parseWords(hrd, make(map[string]int), t.Case)
+	hash, err := hrd.Hash()
+	if err != nil {
+		fmt.Fprintf(diagOut, "An error has occured while trying to read %s: %s\n", dictFile, err)
+		os.Exit(1)
+	}
+	if hash != t.WordlistHash {
+		fmt.Fprintf(diagOut, "Wordlist %s is not the one the transcript was written with (SHA-256 %s, expected %s).\n", dictFile, hash, t.WordlistHash)
+		os.Exit(REPLAY_MISMATCH)
+	}
+	if len(words) < 2 {
+		fmt.Fprintf(diagOut, "Discovered only %d words in %s.\n", len(words), dictFile)
+		os.Exit(REPLAY_MISMATCH)
+	}
+	pass, mismatches := replayTranscript(t, words, codes)
+	for _, m := range mismatches {
+		fmt.Fprintf(diagOut, "MISMATCH: %s.\n", m)
+	}
+	if len(mismatches) > 0 {
+		fmt.Fprintf(diagOut, "Transcript %s does not match, found %d mismatches.\n", fname, len(mismatches))
+		os.Exit(REPLAY_MISMATCH)
+	}
+	fmt.Fprintf(diagOut, "Transcript matches: %d words recomputed from the rolls against wordlist %s.\n", len(t.Entries), dictFile)
+	fmt.Println(pass)
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2023, VigilantDoomer
+//
+// This file is part of Offend program.
+//
+// Offend is free software: you can redistribute it
+// and/or modify it under the terms of GNU General Public License
+// as published by the Free Software Foundation, either version 3 of
+// the License, or (at your option) any later version.
+//
+// Offend is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Offend.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type replay_testrecord struct {
+	// Changes the transcript before it is replayed
+	tamper     func(t *Transcript)
+	mismatches int
+}
+
+// Words w0..w35 chosen with two d6 dice
+func replayWords() [][]byte {
+	words := make([][]byte, 36)
+	for i := range words {
+		words[i] = []byte(fmt.Sprintf("w%d", i))
+	}
+	return words
+}
+
+func sessionTranscript(t *testing.T) *Transcript {
+	script := "11\n2-3\nundo\n6 6\n4 4\n"
+	saved := inputReader
+	defer func() { inputReader = saved }()
+	inputReader = newSecretReader(strings.NewReader(script))
+
+	fname := filepath.Join(t.TempDir(), "transcript")
+	r := new(RealDiceImpl)
+	r.SetDiceFaces(6)
+	r.SetTranscript(&Transcript{WordlistKind: TranscriptDictFile, Wordlist: "words.txt", WordlistHash: "00ff", Case: CaseNone}, fname)
+	pass := samplePassphrase(t, r, replayWords(), 3, "-")
+	if pass != "w0-w35-w21" {
+		t.Fatalf("got passphrase %s, expected w0-w35-w21", pass)
+	}
+	f, err := os.Open(fname)
+	if err != nil {
+		t.Fatalf("transcript was not written: %s", err.Error())
+	}
+	defer f.Close()
+	tr, err := readTranscript(f)
+	if err != nil {
+		t.Fatalf("transcript can't be read back: %s", err.Error())
+	}
+	return tr
+}
+
+func TestTranscriptRoundTrip(t *testing.T) {
+	tr := sessionTranscript(t)
+	if tr.WordlistKind != TranscriptDictFile || tr.Wordlist != "words.txt" || tr.WordlistHash != "00ff" ||
+		tr.Delimiter != "-" || tr.Usable != 36 || !cmpInts(tr.Dice, []int{6, 6}) || len(tr.Entries) != 3 {
+		t.Fatalf("transcript header was not read back: %+v", tr)
+	}
+	e := tr.Entries[1]
+	if !cmpInts(e.Rolls, []int{6, 6}) || e.Value != 35 || e.Index != 35 || e.Code != "66" || e.Word != "w35" {
+		t.Errorf("undone word was not replaced in transcript: %+v", e)
+	}
+	var buf bytes.Buffer
+	if err := writeTranscript(&buf, tr); err != nil {
+		t.Fatal(err)
+	}
+	again, err := readTranscript(&buf)
+	if err != nil || len(again.Entries) != 3 || again.Entries[2].Word != "w21" {
+		t.Errorf("transcript changed after writing it again: %+v (error %v)", again, err)
+	}
+}
+
+func TestReplayTranscript(t *testing.T) {
+	dataset := []replay_testrecord{
+		replay_testrecord{tamper: func(t *Transcript) {}, mismatches: 0},
+		replay_testrecord{tamper: func(t *Transcript) { t.Entries[0].Word = "w1" }, mismatches: 1},
+		replay_testrecord{tamper: func(t *Transcript) { t.Entries[1].Rolls = []int{6, 5} }, mismatches: 4},
+		replay_testrecord{tamper: func(t *Transcript) { t.Entries[2].Rolls = []int{4, 7} }, mismatches: 1},
+		replay_testrecord{tamper: func(t *Transcript) { t.Entries[2].Rolls = []int{4} }, mismatches: 1},
+		replay_testrecord{tamper: func(t *Transcript) { t.Usable = 30 }, mismatches: 1},
+	}
+	for num, testrecord := range dataset {
+		tr := sessionTranscript(t)
+		testrecord.tamper(tr)
+		pass, mismatches := replayTranscript(tr, replayWords(), nil)
+		if len(mismatches) != testrecord.mismatches {
+			t.Errorf("test number %d failed\n   got: %d mismatches %v\n   expected: %d\n", num+1, len(mismatches), mismatches, testrecord.mismatches)
+		}
+		if testrecord.mismatches == 0 && pass != "w0-w35-w21" {
+			t.Errorf("test number %d failed: got passphrase %s, expected w0-w35-w21", num+1, pass)
+		}
+	}
+}
+
+// Words with spaces and quotes are read back as they were written
+func TestTranscriptWordQuoting(t *testing.T) {
+	for num, word := range []string{"ice cream", "say \"hi\"", "the chosen one", "w1"} {
+		tr := &Transcript{WordlistKind: TranscriptDictFile, Wordlist: "words.txt", WordlistHash: "00ff", Case: CaseNone,
+			Dice: []int{6}, Usable: 6, Entries: []TranscriptEntry{transcriptEntry([]int{2}, []int{6}, 1, []byte(word))}}
+		var buf bytes.Buffer
+		if err := writeTranscript(&buf, tr); err != nil {
+			t.Fatal(err)
+		}
+		again, err := readTranscript(&buf)
+		if err != nil || len(again.Entries) != 1 || again.Entries[0].Word != word {
+			t.Errorf("test number %d failed\n   got: %+v (error %v)\n   expected: word %q\n", num+1, again, err, word)
+		}
+	}
+}